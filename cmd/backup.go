@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"sftp-sync/internal/backup"
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/deps"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/lock"
+	"sftp-sync/internal/notify"
+	"sftp-sync/internal/syncstate"
+)
+
+// backupBeforeUp saves remote files that an upload is about to overwrite or delete.
+// ops is the upload's plan.
+func backupBeforeUp(profileName string, profile *config.Profile, subdir string, ops []lftp.Operation, r *reporter) error {
+	if profile.DisableBackups {
+		return nil
+	}
+
+	var files, dirs []string
+	for _, op := range ops {
+		if op.Action != lftp.ActionUpload && op.Action != lftp.ActionDelete {
+			continue
+		}
+		remote := path.Join(profile.RemotePath, filepath.ToSlash(subdir), op.Path)
+		if op.IsDir {
+			dirs = append(dirs, remote)
+		} else {
+			files = append(files, remote)
+		}
+	}
+
+	snapshot, err := backup.Remote(profileName, profile, "up", files, dirs)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	reportBackup(profileName, snapshot, r)
+	return nil
+}
+
+// backupBeforeDown saves local files that a download is about to overwrite or delete.
+// ops is the download's plan.
+func backupBeforeDown(profileName string, profile *config.Profile, subdir string, ops []lftp.Operation, r *reporter) error {
+	if profile.DisableBackups {
+		return nil
+	}
+
+	absLocal, err := filepath.Abs(profile.Context)
+	if err != nil {
+		return fmt.Errorf("cannot resolve local path: %w", err)
+	}
+
+	var paths []string
+	for _, op := range ops {
+		if op.Action == lftp.ActionDownload || op.Action == lftp.ActionDelete {
+			paths = append(paths, filepath.Join(absLocal, subdir, op.Path))
+		}
+	}
+
+	snapshot, err := backup.Local(profileName, profile, "down", paths)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	reportBackup(profileName, snapshot, r)
+	return nil
+}
+
+// reportBackup prints where overwritten files were saved
+func reportBackup(profileName string, snapshot *backup.Snapshot, r *reporter) {
+	if snapshot == nil {
+		return
+	}
+	r.Printf("  Backed up %d %s file(s) to snapshot %s (restore with: sftp-sync restore %s %s)\n",
+		len(snapshot.Files), snapshot.Side, snapshot.ID, profileName, snapshot.ID)
+}
+
+// Backups lists backup snapshots for a profile
+func Backups(profileName string) error {
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+
+	// Make sure the profile exists
+	if _, err := cfg.GetProfile(profileName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+
+	snapshots, err := backup.List(profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Printf("No backups for %s\n", profileName)
+		return nil
+	}
+
+	fmt.Printf("Backups for %s (%d):\n", profileName, len(snapshots))
+	for _, s := range snapshots {
+		fmt.Printf("  • %s  %-6s  %-6s  %d file(s)  %s\n",
+			s.ID, s.Operation, s.Side, len(s.Files), s.Created.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+// recordRestored marks the files of restored local paths (files or
+// directories) as synced, so the daemon's catch-up doesn't upload them
+func recordRestored(profileName string, paths []string) error {
+	return syncstate.Update(profileName, func(s *syncstate.State) {
+		for _, p := range paths {
+			filepath.WalkDir(p, func(f string, d os.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() {
+					s.Record(f)
+				}
+				return nil
+			})
+		}
+	})
+}
+
+// Restore puts files from a backup snapshot back where they were taken from
+// With opts.DryRun set, only the files that would be restored are printed.
+func Restore(profileName, snapshotID, filter string, opts SyncOptions) error {
+	// Check dependencies
+	if err := deps.CheckRequired("lftp", "notify-send"); err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
+	}
+
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
+	}
+
+	// Get profile
+	profile, err := cfg.GetProfile(profileName)
+	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
+	}
+
+	snapshot, err := backup.Find(profileName, snapshotID)
+	if err != nil {
+		notify.Error("SFTP Restore Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return err
+	}
+
+	ops, err := backup.PlanRestore(snapshot, filter)
+	if err != nil {
+		notify.Error("SFTP Restore Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ Restore failed: %v\n", err)
+		return err
+	}
+
+	if opts.DryRun {
+		printOperations(defaultReporter, ops, "")
+		reportDryRun(defaultReporter, len(ops))
+		return nil
+	}
+
+	// Only one sftp-sync process changes a profile at a time
+	l, err := lock.Acquire(profileName, "restore", opts.Wait)
+	if err != nil {
+		notify.Error("SFTP Restore Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+	defer l.Release()
+
+	// Restoring a remote snapshot overwrites files on the server
+	if snapshot.Side == backup.SideRemote {
+		if err := profile.CheckWritable(); err != nil {
+			notify.Error("SFTP Restore Error", err.Error())
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+			return err
+		}
+		summary := []string{fmt.Sprintf("Restore %s to %s: %s", snapshot.ID, profile.Host, summarizeOperations(ops))}
+		if err := confirmProtected(profileName, profile, summary, opts.Yes); err != nil {
+			notify.Error("SFTP Restore Error", err.Error())
+			return err
+		}
+	}
+
+	// Keep a running daemon from uploading the restored local files
+	if snapshot.Side == backup.SideLocal {
+		var paths []string
+		for _, op := range ops {
+			paths = append(paths, op.Path)
+		}
+		if done, err := syncstate.Expect(profileName, paths...); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else {
+			defer done()
+		}
+	}
+
+	restored, err := backup.Restore(profile, snapshot, filter)
+	if err != nil {
+		notify.Error("SFTP Restore Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ Restore failed: %v\n", err)
+		return err
+	}
+	if snapshot.Side == backup.SideLocal {
+		if err := recordRestored(profileName, restored); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to update sync state: %v\n", err)
+		}
+	}
+
+	printOperations(defaultReporter, ops, "")
+	notify.Success("SFTP Restore Complete", fmt.Sprintf("Restored %d %s file(s) from %s", len(restored), snapshot.Side, snapshot.ID))
+	fmt.Printf("✓ Restored %d %s file(s) from %s\n", len(restored), snapshot.Side, snapshot.ID)
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/lftp"
+)
+
+// confirmProtected asks for the profile name to be typed before a protected
+// profile is changed. summary describes what is about to happen.
+// Non-interactive runs must pass --yes instead.
+func confirmProtected(profileName string, profile *config.Profile, summary []string, yes bool) error {
+	if !profile.Protected || yes {
+		return nil
+	}
+
+	label := profileName
+	if profile.Environment != "" {
+		label = fmt.Sprintf("%s (%s)", profileName, profile.Environment)
+	}
+
+	if !isTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "✗ %s is a protected profile: pass --yes to confirm in non-interactive use\n", label)
+		return fmt.Errorf("profile '%s' is protected: confirmation required (--yes)", profileName)
+	}
+
+	fmt.Fprintf(os.Stderr, "⚠ %s is a protected profile\n", label)
+	for _, line := range summary {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+	fmt.Fprintf(os.Stderr, "Type the profile name to continue: ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("confirmation aborted")
+	}
+	if strings.TrimSpace(answer) != profileName {
+		fmt.Fprintf(os.Stderr, "✗ Confirmation failed, nothing was changed\n")
+		return fmt.Errorf("confirmation failed for protected profile '%s'", profileName)
+	}
+
+	return nil
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// summarizeOperations counts planned operations by action, e.g. "upload: 12, delete: 3"
+func summarizeOperations(plans ...[]lftp.Operation) string {
+	actions := []string{lftp.ActionUpload, lftp.ActionDownload, lftp.ActionDelete, lftp.ActionMkdir, lftp.ActionChmod}
+	counts := make(map[string]int)
+	for _, ops := range plans {
+		for _, op := range ops {
+			counts[op.Action]++
+		}
+	}
+
+	var parts []string
+	for _, action := range actions {
+		if counts[action] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", action, counts[action]))
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -1,16 +1,21 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/fsnotify/fsnotify"
 
 	"sftp-sync/internal/config"
 	"sftp-sync/internal/deps"
+	"sftp-sync/internal/notify"
 	"sftp-sync/internal/watcher"
 )
 
@@ -50,14 +55,31 @@ func Daemon() error {
 	// Start queue processor
 	queue.Start(
 		// On success
-		func(profileName, relPath string) {
-			fmt.Fprintf(os.Stderr, "✓ Uploaded: %s → %s\n", relPath, profileName)
+		func(profileName string, op watcher.Op, relPath string) {
+			switch op {
+			case watcher.OpDelete:
+				fmt.Fprintf(os.Stderr, "✓ Deleted: %s on %s\n", relPath, profileName)
+				relPath += " (deleted)"
+			case watcher.OpRename:
+				fmt.Fprintf(os.Stderr, "✓ Renamed: %s on %s\n", relPath, profileName)
+			case watcher.OpDownload:
+				fmt.Fprintf(os.Stderr, "✓ Downloaded: %s ← %s\n", relPath, profileName)
+				relPath += " (downloaded)"
+			default:
+				fmt.Fprintf(os.Stderr, "✓ Uploaded: %s → %s\n", relPath, profileName)
+			}
 			notifier.ResetErrorCount(profileName)
 			notifier.NotifySuccess(profileName, relPath)
 		},
 		// On error
-		func(profileName, relPath string, err error, failCount int) {
-			fmt.Fprintf(os.Stderr, "✗ Upload failed after %d attempts: %s → %s (%v)\n", failCount, relPath, profileName, err)
+		func(profileName string, op watcher.Op, relPath string, err error, failCount int) {
+			if errors.Is(err, watcher.ErrConflict) {
+				fmt.Fprintf(os.Stderr, "⚠ Conflict: %s on %s %v; local copy kept (resolve with push or pull)\n", relPath, profileName, err)
+				notify.Warning("Auto-sync conflict", fmt.Sprintf("%s → %s\nChanged locally and on the remote; local copy kept", relPath, profileName))
+				return
+			}
+			label := strings.ToUpper(string(op[:1])) + string(op[1:])
+			fmt.Fprintf(os.Stderr, "✗ %s failed after %d attempts: %s → %s (%v)\n", label, failCount, relPath, profileName, err)
 			notifier.NotifyError(profileName, relPath, err)
 		},
 	)
@@ -68,20 +90,26 @@ func Daemon() error {
 		// Make a copy of the profile to avoid pointer issues
 		p := profile
 
-		if !p.AutoSync {
+		if !p.AutoSync && !p.AutoSyncDown {
 			continue
 		}
 
-		// Validate context exists
-		if p.Context == "" {
+		// Profiles the daemon may not upload to can still download (autoSyncDown)
+		if err := p.CheckDaemon(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Profile '%s': %v (skipping)\n", name, err)
+			continue
+		}
+
+		// Validate local paths are known
+		if !hasLocalPaths(&p) {
 			fmt.Fprintf(os.Stderr, "Warning: Profile '%s' has autoSync enabled but no context set (skipping)\n", name)
 			continue
 		}
 
 		// Watch this profile
-		err := w.Watch(name, &p, func(filePath string) {
-			// Enqueue upload
-			queue.Enqueue(name, filePath)
+		err := w.Watch(name, &p, func(change watcher.Change) {
+			// Enqueue upload, delete or rename
+			queue.Enqueue(name, change)
 		})
 
 		if err != nil {
@@ -98,6 +126,13 @@ func Daemon() error {
 
 	fmt.Fprintf(os.Stderr, "Daemon started, watching %d profile(s)\n", watchedCount)
 
+	// Upload what changed while the daemon wasn't running
+	for name, profile := range profiles {
+		if w.Watching(name) {
+			catchUp(name, profile, queue)
+		}
+	}
+
 	// Start processing events
 	w.Start()
 
@@ -157,6 +192,43 @@ func Daemon() error {
 	return nil
 }
 
+// hasLocalPaths reports whether every mapping of a profile has an absolute local directory.
+// The daemon can't detect a context from an editor file, so it needs these up front.
+func hasLocalPaths(profile *config.Profile) bool {
+	for _, m := range profile.GetMappings() {
+		if !filepath.IsAbs(m.Local) {
+			return false
+		}
+	}
+	return true
+}
+
+// catchingUp holds the names of profiles with a catch-up in progress
+var catchingUp sync.Map
+
+// catchUp queues, in the background, the changes made while a profile wasn't
+// watched, with one summary notification
+func catchUp(profileName string, profile *config.Profile, queue *watcher.UploadQueue) {
+	// A reload during a catch-up doesn't start another one
+	if _, running := catchingUp.LoadOrStore(profileName, true); running {
+		return
+	}
+
+	go func() {
+		defer catchingUp.Delete(profileName)
+
+		count, err := watcher.CatchUp(profileName, profile, queue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Catch-up for '%s' failed: %v\n", profileName, err)
+			return
+		}
+		if count > 0 {
+			fmt.Fprintf(os.Stderr, "Catching up: %d change(s) queued for %s\n", count, profileName)
+			notify.Info("Auto-sync catching up", fmt.Sprintf("%d change(s) made while not watching → %s", count, profileName))
+		}
+	}()
+}
+
 // handleConfigReload reloads config and adjusts watched profiles
 func handleConfigReload(w *watcher.Watcher, profiles map[string]*config.Profile, queue *watcher.UploadQueue) {
 	// Load new config
@@ -182,8 +254,8 @@ func handleConfigReload(w *watcher.Watcher, profiles map[string]*config.Profile,
 	for oldName, oldProfile := range profiles {
 		newProfile, exists := newProfiles[oldName]
 
-		if !exists || !newProfile.AutoSync {
-			// Profile removed or autoSync disabled
+		if !exists || (!newProfile.AutoSync && !newProfile.AutoSyncDown) || newProfile.CheckDaemon() != nil {
+			// Profile removed, autoSync disabled or no longer allowed
 			err := w.Unwatch(oldName)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Warning: Failed to unwatch profile '%s': %v\n", oldName, err)
@@ -191,39 +263,50 @@ func handleConfigReload(w *watcher.Watcher, profiles map[string]*config.Profile,
 				fmt.Fprintf(os.Stderr, "Stopped watching: %s (removed or autoSync disabled)\n", oldName)
 			}
 			delete(profiles, oldName)
-		} else if newProfile.Context != oldProfile.Context {
-			// Context changed - restart watching
+		} else if !reflect.DeepEqual(newProfile.GetMappings(), oldProfile.GetMappings()) ||
+			newProfile.WatchMode != oldProfile.WatchMode || newProfile.PollInterval != oldProfile.PollInterval ||
+			newProfile.AutoSyncDown != oldProfile.AutoSyncDown || newProfile.AutoSyncDownInterval != oldProfile.AutoSyncDownInterval ||
+			newProfile.DownloadOnly() != oldProfile.DownloadOnly() {
+			// Context, mappings or watch mode changed - restart watching
 			err := w.Unwatch(oldName)
 			if err == nil {
-				err = w.Watch(oldName, newProfile, func(filePath string) {
-					queue.Enqueue(oldName, filePath)
+				err = w.Watch(oldName, newProfile, func(change watcher.Change) {
+					queue.Enqueue(oldName, change)
 				})
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Warning: Failed to restart watching '%s': %v\n", oldName, err)
 				} else {
-					fmt.Fprintf(os.Stderr, "Restarted watching: %s (context changed)\n", oldName)
+					fmt.Fprintf(os.Stderr, "Restarted watching: %s (paths or watch mode changed)\n", oldName)
 					profiles[oldName] = newProfile
 				}
 			}
+		} else {
+			// Same paths - pick up other settings such as autoSyncDelete
+			w.Update(oldName, newProfile)
+			profiles[oldName] = newProfile
 		}
 	}
 
 	// 2. Start watching new profiles with autoSync enabled
 	for newName, newProfile := range newProfiles {
-		if !newProfile.AutoSync {
+		if !newProfile.AutoSync && !newProfile.AutoSyncDown {
 			continue
 		}
 
 		_, alreadyWatching := profiles[newName]
 		if !alreadyWatching {
 			// New profile with autoSync
-			if newProfile.Context == "" {
+			if err := newProfile.CheckDaemon(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Profile '%s': %v (skipping)\n", newName, err)
+				continue
+			}
+			if !hasLocalPaths(newProfile) {
 				fmt.Fprintf(os.Stderr, "Warning: Profile '%s' has autoSync enabled but no context set (skipping)\n", newName)
 				continue
 			}
 
-			err := w.Watch(newName, newProfile, func(filePath string) {
-				queue.Enqueue(newName, filePath)
+			err := w.Watch(newName, newProfile, func(change watcher.Change) {
+				queue.Enqueue(newName, change)
 			})
 
 			if err != nil {
@@ -234,4 +317,11 @@ func handleConfigReload(w *watcher.Watcher, profiles map[string]*config.Profile,
 			}
 		}
 	}
+
+	// 3. Catch up on changes the watches may have missed
+	for name, profile := range profiles {
+		if w.Watching(name) {
+			catchUp(name, profile, queue)
+		}
+	}
 }
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/release"
+)
+
+// printOperations prints operations in the structured format shared by real
+// runs and dry runs. root is the destination root the paths are relative to.
+func printOperations(r *reporter, ops []lftp.Operation, root string) {
+	for _, op := range ops {
+		r.Printf("%s\n", op.Format(root))
+	}
+}
+
+// reportDryRun prints the closing line of a dry run
+func reportDryRun(r *reporter, count int) {
+	r.Printf("✓ Dry run: %d operation(s), no changes made\n", count)
+}
+
+// remoteRoot returns the remote directory a target syncs
+func remoteRoot(t syncTarget) string {
+	return path.Join(t.profile.RemotePath, filepath.ToSlash(t.subdir))
+}
+
+// localRoot returns the local directory a target syncs
+func localRoot(t syncTarget) (string, error) {
+	absLocal, err := filepath.Abs(t.profile.Context)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve local path: %w", err)
+	}
+	return filepath.Join(absLocal, t.subdir), nil
+}
+
+// planUp prints what an upload would do and returns the number of operations
+func planUp(profile *config.Profile, targets []syncTarget, opts SyncOptions, r *reporter) (int, error) {
+	if opts.Release {
+		ops, err := release.Plan(targets[0].profile)
+		if err != nil {
+			r.Errorf("✗ Dry run failed: %v\n", err)
+			return 0, err
+		}
+		printOperations(r, ops, targets[0].profile.RemotePath)
+		reportDryRun(r, len(ops))
+		return len(ops), nil
+	}
+
+	count := 0
+	for _, t := range targets {
+		ops, err := lftp.PlanUp(t.profile, t.subdir)
+		if err != nil {
+			r.Errorf("✗ Dry run failed: %v\n", err)
+			return count, err
+		}
+		printOperations(r, ops, remoteRoot(t))
+		count += len(ops)
+	}
+	reportDryRun(r, count)
+	return count, nil
+}
+
+// planDown prints what a download would do
+func planDown(targets []syncTarget, r *reporter) error {
+	count := 0
+	for _, t := range targets {
+		root, err := localRoot(t)
+		if err != nil {
+			r.Errorf("✗ Dry run failed: %v\n", err)
+			return err
+		}
+		ops, err := lftp.PlanDown(t.profile, t.subdir)
+		if err != nil {
+			r.Errorf("✗ Dry run failed: %v\n", err)
+			return err
+		}
+		printOperations(r, ops, root)
+		count += len(ops)
+	}
+	reportDryRun(r, count)
+	return nil
+}
@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"sftp-sync/internal/backup"
 	"sftp-sync/internal/config"
 	"sftp-sync/internal/deps"
+	"sftp-sync/internal/history"
 	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/lock"
 	"sftp-sync/internal/notify"
+	"sftp-sync/internal/syncstate"
 )
 
 // findProjectRoot determines the appropriate context directory for a file operation
@@ -57,8 +62,17 @@ func findProjectRoot(profile *config.Profile, filePath string) (string, error) {
 	}
 }
 
+// scopeToMapping returns the profile scoped to the mapping that contains absFile
+func scopeToMapping(profile *config.Profile, absFile string) (*config.Profile, error) {
+	m, ok := profile.MappingFor(absFile)
+	if !ok {
+		return nil, fmt.Errorf("file '%s' is not within any mapping of this profile", absFile)
+	}
+	return profile.ForMapping(m), nil
+}
+
 // Push uploads a single file
-func Push(profileName, filePath string) error {
+func Push(profileName, filePath string, opts SyncOptions) (err error) {
 	// Check dependencies
 	if err := deps.CheckRequired("lftp", "notify-send"); err != nil {
 		notify.Error("SFTP Sync Error", err.Error())
@@ -79,6 +93,13 @@ func Push(profileName, filePath string) error {
 		return err
 	}
 
+	// Read-only profiles never upload
+	if err := profile.CheckWritable(); err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+
 	// Smart context detection: respects config, falls back to .git detection
 	contextDir, err := findProjectRoot(profile, filePath)
 	if err != nil {
@@ -91,30 +112,100 @@ func Push(profileName, filePath string) error {
 		profile.Context = contextDir
 	}
 
+	// Resolve the file and the mapping it belongs to
+	absFile, err := filepath.Abs(filePath)
+	if err != nil {
+		notify.Error("SFTP Error", err.Error())
+		return err
+	}
+	profile, err = scopeToMapping(profile, absFile)
+	if err != nil {
+		notify.Error("SFTP Error", err.Error())
+		return err
+	}
+
 	// Get relative path for display
 	relPath := filepath.Base(filePath)
-	absFile, err := filepath.Abs(filePath)
-	if err == nil {
-		if rel, err := filepath.Rel(contextDir, absFile); err == nil {
-			relPath = rel
+	if rel, err := filepath.Rel(contextDir, absFile); err == nil {
+		relPath = rel
+	}
+
+	if opts.DryRun {
+		ops, err := lftp.PlanPush(profile, absFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ Dry run failed: %v\n", err)
+			return err
 		}
+		printOperations(defaultReporter, ops, profile.RemotePath)
+		reportDryRun(defaultReporter, len(ops))
+		return nil
+	}
+
+	// Only one sftp-sync process changes a profile at a time
+	l, err := lock.Acquire(profileName, "push", opts.Wait)
+	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+	defer l.Release()
+
+	// Record the upload in the history log once it's done
+	start := time.Now()
+	entry := history.Entry{
+		Profile:   profileName,
+		Direction: history.DirectionPush,
+		GitCommit: history.GitCommit(profile.Context),
+	}
+	defer func() {
+		if err == nil {
+			entry.FileCount = 1
+			entry.Files = []string{absFile}
+			if info, statErr := os.Stat(absFile); statErr == nil {
+				entry.Bytes = info.Size()
+			}
+		}
+		recordHistory(entry, start, err)
+	}()
+
+	summary := []string{fmt.Sprintf("Upload %s to %s:%s", relPath, profile.Host, profile.RemotePath)}
+	if err := confirmProtected(profileName, profile, summary, opts.Yes); err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
 	}
 
 	notify.Info("SFTP Sync", fmt.Sprintf("Uploading %s...", relPath))
 
+	// Save the remote version before overwriting it
+	if remoteFile, err := lftp.RemoteFile(profile, absFile); err == nil {
+		snapshot, err := backup.Remote(profileName, profile, "push", []string{remoteFile}, nil)
+		if err != nil {
+			notify.Error("SFTP Error", fmt.Sprintf("Backup of %s failed", relPath))
+			fmt.Fprintf(os.Stderr, "✗ Backup failed: %v\n", err)
+			return err
+		}
+		reportBackup(profileName, snapshot, defaultReporter)
+	}
+
 	// Upload file
-	if err := lftp.PushFile(profile, filePath); err != nil {
+	if err := lftp.PushFile(profile, absFile); err != nil {
 		notify.Error("SFTP Error", fmt.Sprintf("Failed to upload %s", relPath))
 		return err
 	}
+	if err := syncstate.Record(profileName, absFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to update sync state: %v\n", err)
+	}
 
+	if ops, err := lftp.PlanPush(profile, absFile); err == nil {
+		printOperations(defaultReporter, ops, profile.RemotePath)
+	}
 	notify.Success("File Uploaded", fmt.Sprintf("%s → %s", relPath, profile.Host))
 	fmt.Printf("✓ Uploaded: %s\n", relPath)
 	return nil
 }
 
 // Pull downloads a single file
-func Pull(profileName, filePath string) error {
+func Pull(profileName, filePath string, opts SyncOptions) (err error) {
 	// Check dependencies
 	if err := deps.CheckRequired("lftp", "notify-send"); err != nil {
 		notify.Error("SFTP Sync Error", err.Error())
@@ -147,24 +238,96 @@ func Pull(profileName, filePath string) error {
 		profile.Context = contextDir
 	}
 
+	// Resolve the file and the mapping it belongs to
+	// (relative paths are relative to the context)
+	localFile, err := lftp.LocalFile(profile, filePath)
+	if err != nil {
+		notify.Error("SFTP Error", err.Error())
+		return err
+	}
+	profile, err = scopeToMapping(profile, localFile)
+	if err != nil {
+		notify.Error("SFTP Error", err.Error())
+		return err
+	}
+
 	// Get relative path for display
 	relPath := filepath.Base(filePath)
 
+	if opts.DryRun {
+		ops, err := lftp.PlanPull(profile, localFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ Dry run failed: %v\n", err)
+			return err
+		}
+		printOperations(defaultReporter, ops, profile.Context)
+		reportDryRun(defaultReporter, len(ops))
+		return nil
+	}
+
+	// Only one sftp-sync process changes a profile at a time
+	l, err := lock.Acquire(profileName, "pull", opts.Wait)
+	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+	defer l.Release()
+
+	// Record the download in the history log once it's done
+	start := time.Now()
+	entry := history.Entry{
+		Profile:   profileName,
+		Direction: history.DirectionPull,
+	}
+	defer func() {
+		if err == nil {
+			entry.FileCount = 1
+			entry.Files = []string{localFile}
+			if info, statErr := os.Stat(localFile); statErr == nil {
+				entry.Bytes = info.Size()
+			}
+		}
+		recordHistory(entry, start, err)
+	}()
+
 	notify.Info("SFTP Sync", fmt.Sprintf("Downloading %s...", relPath))
 
+	// Save the local version before overwriting it
+	snapshot, err := backup.Local(profileName, profile, "pull", []string{localFile})
+	if err != nil {
+		notify.Error("SFTP Error", fmt.Sprintf("Backup of %s failed", relPath))
+		fmt.Fprintf(os.Stderr, "✗ Backup failed: %v\n", err)
+		return err
+	}
+	reportBackup(profileName, snapshot, defaultReporter)
+
+	// Keep a running daemon from uploading the downloaded file
+	if done, err := syncstate.Expect(profileName, localFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		defer done()
+	}
+
 	// Download file
-	if err := lftp.PullFile(profile, filePath); err != nil {
+	if err := lftp.PullFile(profile, localFile); err != nil {
 		notify.Error("SFTP Error", fmt.Sprintf("Failed to download %s", relPath))
 		return err
 	}
+	if err := syncstate.Record(profileName, localFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to update sync state: %v\n", err)
+	}
 
+	if ops, err := lftp.PlanPull(profile, localFile); err == nil {
+		printOperations(defaultReporter, ops, profile.Context)
+	}
 	notify.Success("File Downloaded", fmt.Sprintf("%s ← %s", relPath, profile.Host))
 	fmt.Printf("✓ Downloaded: %s\n", relPath)
 	return nil
 }
 
 // Current uploads the current file (for editor integration)
-func Current(profileName, filePath string) error {
+func Current(profileName, filePath string, opts SyncOptions) error {
 	// This is the same as Push but with different messaging
-	return Push(profileName, filePath)
+	return Push(profileName, filePath, opts)
 }
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/gitrepo"
+	"sftp-sync/internal/lftp"
+)
+
+// maxListedConflicts is how many uncommitted files a refused download lists
+const maxListedConflicts = 10
+
+// gitConflicts returns files with uncommitted changes (including untracked
+// files) that a download's plans would overwrite or delete. Paths are
+// compared with symlinks resolved, as the context may be reached through a
+// link into the repository (or the repository through a link).
+func gitConflicts(repo *gitrepo.Repo, targets []syncTarget, plans [][]lftp.Operation) ([]string, error) {
+	dirty, err := repo.Dirty()
+	if err != nil {
+		return nil, err
+	}
+	if len(dirty) == 0 {
+		return nil, nil
+	}
+
+	files := make(map[string]bool)
+	var dirs []string
+	for i, t := range targets {
+		root, err := localRoot(t)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range plans[i] {
+			if op.Action != lftp.ActionDownload && op.Action != lftp.ActionDelete {
+				continue
+			}
+			p := realPath(filepath.Join(root, op.Path))
+			if op.IsDir {
+				dirs = append(dirs, p+"/")
+			} else {
+				files[p] = true
+			}
+		}
+	}
+
+	var conflicts []string
+	for _, p := range dirty {
+		resolved := realPath(p)
+		if files[resolved] {
+			conflicts = append(conflicts, p)
+			continue
+		}
+		for _, dir := range dirs {
+			if strings.HasPrefix(resolved, dir) {
+				conflicts = append(conflicts, p)
+				break
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// realPath resolves the symlinks in the part of p that exists; the rest
+// (files a download would create, or a deleted file) is appended unchanged
+func realPath(p string) string {
+	var rest []string
+	for dir := p; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return p
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
+// protectWorkingTree stops a download from silently discarding uncommitted
+// work: conflicting files are stashed with --stash, overwritten with --force
+// (the backup snapshot still has them), and otherwise the download is refused
+func protectWorkingTree(profileName string, profile *config.Profile, repo *gitrepo.Repo, targets []syncTarget, plans [][]lftp.Operation, opts SyncOptions) error {
+	conflicts, err := gitConflicts(repo, targets, plans)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Cannot check git status: %v\n", err)
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	switch {
+	case opts.Stash:
+		if err := repo.Stash(fmt.Sprintf("sftp-sync down %s", profileName), conflicts); err != nil {
+			fmt.Fprintf(os.Stderr, "✗ Stash failed: %v\n", err)
+			return err
+		}
+		fmt.Printf("  Stashed %d file(s) with uncommitted changes (restore with: git stash pop)\n", len(conflicts))
+		return nil
+
+	case opts.Force:
+		fmt.Fprintf(os.Stderr, "⚠ Overwriting %d file(s) with uncommitted changes\n", len(conflicts))
+		if profile.DisableBackups {
+			fmt.Fprintf(os.Stderr, "⚠ Backups are disabled for this profile: those changes will be lost\n")
+		}
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "✗ Refusing to download: %d file(s) with uncommitted changes would be overwritten or deleted\n", len(conflicts))
+	for i, p := range conflicts {
+		if i == maxListedConflicts {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(conflicts)-maxListedConflicts)
+			break
+		}
+		if rel, err := filepath.Rel(repo.Root, p); err == nil {
+			p = rel
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", p)
+	}
+	fmt.Fprintf(os.Stderr, "  Commit them first, or run with --stash to stash them or --force to overwrite them\n")
+
+	return fmt.Errorf("refusing to download: %d file(s) with uncommitted changes", len(conflicts))
+}
+
+// reportGitChanges shows what a download changed in the git working tree and,
+// with --commit-to, records the downloaded state as a commit on that branch
+func reportGitChanges(profileName string, profile *config.Profile, repo *gitrepo.Repo, targets []syncTarget, opts SyncOptions) error {
+	var roots []string
+	for _, t := range targets {
+		root, err := localRoot(t)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, root)
+	}
+
+	stat, err := repo.DiffStat(roots)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Cannot show git diff: %v\n", err)
+	} else if strings.TrimSpace(stat) != "" {
+		fmt.Printf("Changes from the server (git diff --stat):\n%s", stat)
+	}
+
+	if opts.CommitTo == "" {
+		return nil
+	}
+
+	message := fmt.Sprintf("Remote state of %s (%s:%s)\n\nRecorded by sftp-sync down at %s",
+		profileName, profile.Host, profile.RemotePath, time.Now().Format(time.RFC3339))
+	commit, err := repo.CommitTo(opts.CommitTo, message, roots)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ Failed to record remote state on %s: %v\n", opts.CommitTo, err)
+		return err
+	}
+	fmt.Printf("✓ Recorded remote state on branch %s (%s)\n", opts.CommitTo, shortCommit(commit))
+	return nil
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sftp-sync/internal/history"
+)
+
+// HistoryOptions holds command-line options for the history command
+type HistoryOptions struct {
+	Direction string // Only this direction (up, down, push, pull, daemon, daemon-down)
+	Since     string // Duration ("24h", "7d") or date ("2006-01-02")
+	Limit     int    // Show only the newest N entries
+	Failed    bool   // Show only failed operations
+	JSON      bool   // Print entries as a JSON array
+}
+
+// recordHistory appends an operation to the history log.
+// A failure to write the log is reported but never fails the operation itself.
+func recordHistory(entry history.Entry, start time.Time, err error) {
+	entry.Time = start
+	entry.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if recordErr := history.Record(entry); recordErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to record history: %v\n", recordErr)
+	}
+}
+
+// History prints recorded sync operations
+func History(profileName string, opts HistoryOptions) error {
+	filter := history.Filter{
+		Profile:   profileName,
+		Direction: opts.Direction,
+		Failed:    opts.Failed,
+		Limit:     opts.Limit,
+	}
+
+	if opts.Since != "" {
+		since, err := parseSince(opts.Since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return err
+		}
+		filter.Since = since
+	}
+
+	entries, err := history.Read(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+
+	if opts.JSON {
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No history")
+		return nil
+	}
+
+	for _, e := range entries {
+		status := "✓"
+		if e.Error != "" {
+			status = "✗"
+		}
+
+		commit := "-"
+		if e.GitCommit != "" {
+			commit = shortCommit(e.GitCommit)
+		}
+
+		direction := e.Direction
+		if e.Operation != "" && e.Direction == history.DirectionDaemon {
+			direction += ":" + e.Operation
+		}
+
+		fmt.Printf("%s %s  %-13s  %-12s  %4d files  %9s  %7s  %-14s  %s@%s\n",
+			status,
+			e.Time.Format("2006-01-02 15:04:05"),
+			direction,
+			e.Profile,
+			e.FileCount,
+			formatBytes(e.Bytes),
+			e.Duration().Round(100*time.Millisecond),
+			commit,
+			e.User,
+			e.Hostname,
+		)
+		if e.Release != "" {
+			fmt.Printf("    release: %s\n", e.Release)
+		}
+		if e.OldPath != "" && len(e.Files) > 0 {
+			fmt.Printf("    renamed: %s → %s\n", e.OldPath, e.Files[0])
+		}
+		if e.Error != "" {
+			fmt.Printf("    error: %s\n", e.Error)
+		}
+	}
+
+	return nil
+}
+
+// parseSince parses a relative duration ("90m", "24h", "7d") or a date ("2006-01-02")
+func parseSince(value string) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value '%s' (use e.g. 24h, 7d or 2006-01-02)", value)
+}
+
+// shortCommit abbreviates a commit hash, keeping any -dirty suffix
+func shortCommit(commit string) string {
+	hash, dirty := strings.CutSuffix(commit, "-dirty")
+	if len(hash) > 8 {
+		hash = hash[:8]
+	}
+	if dirty {
+		hash += "-dirty"
+	}
+	return hash
+}
+
+// formatBytes formats a byte count for display
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/syncignore"
+)
+
+// CheckIgnore prints, for each path, whether it is ignored in the given
+// direction and which rule decided it. Paths are relative to the context or absolute.
+func CheckIgnore(profileName string, paths []string, direction string) error {
+	dir := syncignore.Up
+	switch direction {
+	case "", string(syncignore.Up):
+	case string(syncignore.Down):
+		dir = syncignore.Down
+	default:
+		err := fmt.Errorf("invalid direction '%s': must be up or down", direction)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+
+	profile, err := cfg.GetProfile(profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return err
+	}
+	if profile.Context == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("cannot determine current directory: %w", err)
+		}
+		profile.Context = cwd
+	}
+
+	// Matchers are loaded once per mapping
+	matchers := make(map[string]*syncignore.Matcher)
+
+	var failed error
+	for _, p := range paths {
+		localPath, err := lftp.LocalFile(profile, p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", p, err)
+			failed = err
+			continue
+		}
+		localPath = filepath.Clean(localPath)
+
+		m, ok := profile.MappingFor(localPath)
+		if !ok {
+			err := fmt.Errorf("not within any mapping of this profile")
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", p, err)
+			failed = err
+			continue
+		}
+
+		matcher, ok := matchers[m.Local]
+		if !ok {
+			matcher, err = syncignore.ForProfile(profile.ForMapping(m), dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "✗ Failed to load ignore rules: %v\n", err)
+				return err
+			}
+			matchers[m.Local] = matcher
+		}
+
+		relPath, err := filepath.Rel(m.Local, localPath)
+		if err != nil || relPath == "." {
+			fmt.Printf("%s: not ignored (mapping root)\n", p)
+			continue
+		}
+
+		// Paths that don't exist are checked as files unless they end in a slash
+		isDir := len(p) > 0 && os.IsPathSeparator(p[len(p)-1])
+		if info, err := os.Stat(localPath); err == nil {
+			isDir = info.IsDir()
+		}
+
+		rule := matcher.Explain(relPath, isDir)
+		switch {
+		case rule == nil:
+			fmt.Printf("%s: not ignored\n", p)
+		case rule.Negate:
+			fmt.Printf("%s: not ignored, re-included by %s\n", p, rule)
+		default:
+			fmt.Printf("%s: ignored by %s\n", p, rule)
+		}
+	}
+
+	return failed
+}
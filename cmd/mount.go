@@ -76,6 +76,9 @@ func Mount(profileName string, openYazi bool) error {
 		notify.Error("Mount Error", err.Error())
 		return err
 	}
+	if profile.ReadOnly {
+		fmt.Println("Mounted read-only (profile has readOnly set)")
+	}
 
 	if openYazi {
 		// Launch kitty with yazi
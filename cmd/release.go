@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/deps"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/lock"
+	"sftp-sync/internal/notify"
+	"sftp-sync/internal/release"
+)
+
+// upRelease uploads into a new release directory and switches the current symlink
+func upRelease(profile *config.Profile, r *reporter) (*release.Deployment, error) {
+	r.Info("SFTP Sync", fmt.Sprintf("Deploying release to %s...", profile.Host))
+
+	deployment, err := release.Deploy(profile)
+	if err != nil {
+		r.Error("SFTP Error", fmt.Sprintf("Release deploy failed: %v", err))
+		r.Errorf("✗ Release deploy failed!\n")
+		r.Errorf("✗ Error: %v\n", err)
+		if deployment != nil && deployment.Previous != "" {
+			r.Errorf("  Live release unchanged: %s\n", deployment.Previous)
+		}
+		return deployment, err
+	}
+
+	msg := fmt.Sprintf("Released %s to %s\nFiles synced: %d", deployment.Release, profile.Host, deployment.Result.FileCount)
+	r.Success("SFTP Release Complete", msg)
+	r.Printf("✓ Release %s is live: %d files synced\n", deployment.Release, deployment.Result.FileCount)
+	if deployment.Previous != "" {
+		r.Printf("  Previous release: %s (roll back with: sftp-sync rollback <profile>)\n", deployment.Previous)
+	}
+	for _, name := range deployment.Pruned {
+		r.Printf("  Pruned old release: %s\n", name)
+	}
+	return deployment, nil
+}
+
+// Rollback switches the current symlink back to an earlier release.
+// With opts.DryRun set, only the symlink change that would be made is printed.
+func Rollback(profileName, target string, opts SyncOptions) error {
+	// Check dependencies
+	if err := deps.CheckRequired("ssh", "notify-send"); err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
+	}
+
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
+	}
+
+	// Get profile
+	profile, err := cfg.GetProfile(profileName)
+	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		return err
+	}
+
+	// Read-only profiles never change the live release
+	if err := profile.CheckWritable(); err != nil {
+		notify.Error("SFTP Rollback Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+
+	current, next, err := release.RollbackTarget(profile, target)
+	if err != nil {
+		notify.Error("SFTP Rollback Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ Rollback failed: %v\n", err)
+		return err
+	}
+
+	if opts.DryRun {
+		printOperations(defaultReporter, []lftp.Operation{rollbackOperation(next)}, profile.RemotePath)
+		reportDryRun(defaultReporter, 1)
+		return nil
+	}
+
+	// Only one sftp-sync process changes a profile at a time
+	l, err := lock.Acquire(profileName, "rollback", opts.Wait)
+	if err != nil {
+		notify.Error("SFTP Rollback Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+	defer l.Release()
+
+	summary := []string{fmt.Sprintf("Switch %s:%s from %s to %s", profile.Host, profile.RemotePath, current, next)}
+	if err := confirmProtected(profileName, profile, summary, opts.Yes); err != nil {
+		notify.Error("SFTP Rollback Error", err.Error())
+		return err
+	}
+
+	previous, live, err := release.Rollback(profile, next)
+	if err != nil {
+		notify.Error("SFTP Rollback Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ Rollback failed: %v\n", err)
+		return err
+	}
+
+	printOperations(defaultReporter, []lftp.Operation{rollbackOperation(live)}, profile.RemotePath)
+
+	notify.Success("SFTP Rollback Complete", fmt.Sprintf("%s is now live on %s", live, profile.Host))
+	fmt.Printf("✓ Rolled back: %s → %s\n", previous, live)
+	return nil
+}
+
+// rollbackOperation describes repointing the current symlink at a release
+func rollbackOperation(name string) lftp.Operation {
+	return lftp.Operation{Action: lftp.ActionSymlink, Path: release.CurrentLink, Target: path.Join(release.ReleasesDir, name)}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"sftp-sync/internal/notify"
+)
+
+// reporter routes a command's terminal output and desktop notifications.
+// Multi-target runs give each profile its own reporter: lines are prefixed
+// with the profile name and notifications are left to the aggregated summary.
+type reporter struct {
+	prefix string // Prepended to every terminal line
+	quiet  bool   // Suppress desktop notifications
+}
+
+// defaultReporter prints and notifies like a single-profile command
+var defaultReporter = &reporter{}
+
+// targetReporter returns a reporter for one profile of a multi-target run
+func targetReporter(profileName string) *reporter {
+	return &reporter{prefix: fmt.Sprintf("[%s] ", profileName), quiet: true}
+}
+
+// Printf writes a line to stdout
+func (r *reporter) Printf(format string, args ...any) {
+	fmt.Print(r.prefix + fmt.Sprintf(format, args...))
+}
+
+// Errorf writes a line to stderr
+func (r *reporter) Errorf(format string, args ...any) {
+	fmt.Fprint(os.Stderr, r.prefix+fmt.Sprintf(format, args...))
+}
+
+// Info sends an info notification
+func (r *reporter) Info(title, message string) {
+	if !r.quiet {
+		notify.Info(title, message)
+	}
+}
+
+// Success sends a success notification
+func (r *reporter) Success(title, message string) {
+	if !r.quiet {
+		notify.Success(title, message)
+	}
+}
+
+// Warning sends a warning notification
+func (r *reporter) Warning(title, message string) {
+	if !r.quiet {
+		notify.Warning(title, message)
+	}
+}
+
+// Error sends an error notification
+func (r *reporter) Error(title, message string) {
+	if !r.quiet {
+		notify.Error(title, message)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/syncignore"
+)
+
+// maxListedDeletions is how many of the files a refused sync would delete are listed
+const maxListedDeletions = 10
+
+// checkDeletions refuses a mirror that would delete more destination files
+// than the profile allows, or that would mirror an empty source over a
+// populated destination (typically `up` run from the wrong directory when no
+// context is configured). ops is the mirror's plan; download selects which
+// side is the destination. --force skips the check.
+func checkDeletions(t syncTarget, ops []lftp.Operation, download bool, r *reporter) error {
+	var deletes []lftp.Operation
+	for _, op := range ops {
+		if op.Action == lftp.ActionDelete {
+			deletes = append(deletes, op)
+		}
+	}
+	if len(deletes) == 0 {
+		return nil
+	}
+
+	source, dest := lftp.ListLocal, lftp.ListRemote
+	verb, sourceRoot, destRoot := "upload", localRootOrContext(t), remoteRoot(t)
+	if download {
+		source, dest = lftp.ListRemote, lftp.ListLocal
+		verb, sourceRoot, destRoot = "download", remoteRoot(t), localRootOrContext(t)
+	}
+
+	direction := syncignore.Up
+	if download {
+		direction = syncignore.Down
+	}
+
+	sourceFiles, err := source(t.profile, t.subdir, direction)
+	if err != nil {
+		return err
+	}
+	destFiles, err := dest(t.profile, t.subdir, direction)
+	if err != nil {
+		return err
+	}
+
+	// Directory deletions remove everything beneath them
+	count := 0
+	for _, op := range deletes {
+		if !op.IsDir {
+			count++
+			continue
+		}
+		for _, f := range destFiles {
+			if strings.HasPrefix(f, op.Path+"/") {
+				count++
+			}
+		}
+	}
+
+	limit, percent := *t.profile.DeleteLimit, *t.profile.DeleteLimitPercent
+	var reason string
+	switch {
+	case len(sourceFiles) == 0:
+		reason = fmt.Sprintf("%s is empty but %s has %d file(s)", sourceRoot, destRoot, len(destFiles))
+	case limit >= 0 && count > limit:
+		reason = fmt.Sprintf("%d file(s) in %s would be deleted (deleteLimit: %d)", count, destRoot, limit)
+	case percent >= 0 && len(destFiles) > 0 && count*100 > percent*len(destFiles):
+		reason = fmt.Sprintf("%d of %d file(s) (%d%%) in %s would be deleted (deleteLimitPercent: %d%%)",
+			count, len(destFiles), count*100/len(destFiles), destRoot, percent)
+	default:
+		return nil
+	}
+
+	r.Errorf("✗ Refusing to %s: %s\n", verb, reason)
+	for i, op := range deletes {
+		if i == maxListedDeletions {
+			r.Errorf("  ... and %d more\n", len(deletes)-maxListedDeletions)
+			break
+		}
+		r.Errorf("  %s\n", op.Format(destRoot))
+	}
+	r.Errorf("  Check the profile's context and current directory, or run with --force if this is intended\n")
+
+	return fmt.Errorf("refusing to %s: %s", verb, reason)
+}
+
+// localRootOrContext returns the local directory a target syncs, for messages
+func localRootOrContext(t syncTarget) string {
+	if root, err := localRoot(t); err == nil {
+		return root
+	}
+	return t.profile.Context
+}
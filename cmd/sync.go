@@ -3,14 +3,35 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"sftp-sync/internal/config"
 	"sftp-sync/internal/deps"
+	"sftp-sync/internal/gitrepo"
+	"sftp-sync/internal/history"
 	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/lock"
 	"sftp-sync/internal/notify"
+	"sftp-sync/internal/syncignore"
+	"sftp-sync/internal/syncstate"
 )
 
+// SyncOptions holds command-line options for sync commands
+type SyncOptions struct {
+	Release     bool   // Upload into a new release directory and switch the current symlink
+	Concurrency int    // Maximum number of profiles synced at once (multi-target runs)
+	FailFast    bool   // Stop starting new targets after the first failure
+	DryRun      bool   // Print the operations that would be performed without changing anything
+	Force       bool   // Skip the mass-deletion and uncommitted-changes safety checks
+	Yes         bool   // Confirm changes to protected profiles without prompting
+	Stash       bool   // down: stash uncommitted git changes that would be overwritten
+	CommitTo    string // down: record the downloaded state as a commit on this branch
+	Wait        bool   // Wait for another process using the profile instead of failing
+}
+
 // getContext determines the context directory
 // Priority: 1) Config context (if set), 2) Detect from .git, 3) Current working directory
 func getContext(profile *config.Profile, contextFile string) (string, error) {
@@ -33,6 +54,10 @@ func getContext(profile *config.Profile, contextFile string) (string, error) {
 
 	// Absolute path - find project root by looking for .git
 	dir := filepath.Dir(contextFile)
+	if info, err := os.Stat(contextFile); err == nil && info.IsDir() {
+		// Directory given (subtree sync) - start looking from the directory itself
+		dir = contextFile
+	}
 	homeDir, _ := os.UserHomeDir()
 
 	for {
@@ -54,8 +79,123 @@ func getContext(profile *config.Profile, contextFile string) (string, error) {
 	}
 }
 
-// Up performs full upload sync
-func Up(profileName, contextFile string) error {
+// syncTarget is one mapping (or a directory within it) that a sync command operates on
+type syncTarget struct {
+	profile *config.Profile // Profile scoped to the mapping
+	subdir  string          // Directory within the mapping ("" for all of it)
+}
+
+// label describes the target for messages
+func (t syncTarget) label() string {
+	local := filepath.Join(t.profile.Context, t.subdir)
+	remote := path.Join(t.profile.RemotePath, filepath.ToSlash(t.subdir))
+	return fmt.Sprintf("%s → %s", local, remote)
+}
+
+// recordSyncState marks the files of a target that was just synced as being
+// in their last-synced version, for the daemon's catch-up
+func recordSyncState(profileName string, t syncTarget, dir syncignore.Direction, r *reporter) {
+	files, err := lftp.ListLocal(t.profile, t.subdir, dir)
+	if err == nil {
+		root := filepath.Join(t.profile.Context, t.subdir)
+		err = syncstate.Update(profileName, func(s *syncstate.State) {
+			s.Forget(root)
+			for _, rel := range files {
+				s.Record(filepath.Join(root, rel))
+			}
+		})
+	}
+	if err != nil {
+		r.Errorf("Warning: Failed to update sync state: %v\n", err)
+	}
+}
+
+// resolveDir returns the absolute directory named by target, or "" when
+// target is empty or a file (editor integration).
+// A target counts as a directory if it exists as one or ends with a slash;
+// for downloads a path that doesn't exist locally yet also counts.
+func resolveDir(contextDir, target string, download bool) (string, error) {
+	if target == "" {
+		return "", nil
+	}
+
+	info, err := os.Stat(target)
+	isDir := (err == nil && info.IsDir()) || strings.HasSuffix(target, "/") || (download && os.IsNotExist(err))
+	if !isDir {
+		return "", nil
+	}
+
+	absContext, err := filepath.Abs(contextDir)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve context path: %w", err)
+	}
+
+	// Relative paths are taken from the current directory, falling back to the context
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve directory: %w", err)
+	}
+	if !filepath.IsAbs(target) && !strings.HasPrefix(absTarget, absContext+"/") && absTarget != absContext {
+		absTarget = filepath.Join(absContext, target)
+	}
+
+	return absTarget, nil
+}
+
+// resolveTargets returns the mappings a sync command should process.
+// Without a directory target every mapping is synced in full. A directory inside
+// a mapping syncs just that subtree; a directory containing mappings syncs those.
+func resolveTargets(profile *config.Profile, target string, download bool) ([]syncTarget, error) {
+	dir, err := resolveDir(profile.Context, target, download)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []syncTarget
+	if dir == "" {
+		for _, m := range profile.GetMappings() {
+			targets = append(targets, syncTarget{profile: profile.ForMapping(m)})
+		}
+		return targets, nil
+	}
+
+	// Directory inside a mapping - sync that subtree only
+	if m, ok := profile.MappingFor(dir); ok {
+		subdir, err := filepath.Rel(filepath.Clean(m.Local), dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve directory: %w", err)
+		}
+		if subdir == "." {
+			subdir = ""
+		}
+		return []syncTarget{{profile: profile.ForMapping(m), subdir: subdir}}, nil
+	}
+
+	// Directory above one or more mappings - sync those mappings
+	for _, m := range profile.GetMappings() {
+		if strings.HasPrefix(filepath.Clean(m.Local), dir+"/") {
+			targets = append(targets, syncTarget{profile: profile.ForMapping(m)})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("directory '%s' is not within any mapping of this profile", dir)
+	}
+	return targets, nil
+}
+
+// targetsSuffix describes the synced directory for messages ("" for a full sync)
+func targetsSuffix(targets []syncTarget) string {
+	if len(targets) != 1 || targets[0].subdir == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s/)", targets[0].subdir)
+}
+
+// Up performs full upload sync.
+// spec is a profile, a group, or a comma-separated list of either; several
+// targets are uploaded concurrently.
+// target is an optional file (for context detection) or a directory to sync on its own.
+func Up(spec, target string, opts SyncOptions) error {
 	// Check dependencies
 	if err := deps.CheckRequired("lftp", "notify-send"); err != nil {
 		notify.Error("SFTP Sync Error", err.Error())
@@ -69,18 +209,108 @@ func Up(profileName, contextFile string) error {
 		return err
 	}
 
-	// Get profile
-	profile, err := cfg.GetProfile(profileName)
+	// Expand groups and lists into profile names
+	names, err := cfg.ResolveTargets(spec)
 	if err != nil {
 		notify.Error("SFTP Sync Error", err.Error())
 		return err
 	}
 
+	if len(names) == 1 {
+		_, err := upProfile(cfg, names[0], target, opts, defaultReporter)
+		return err
+	}
+
+	// Concurrent uploads can't prompt, so confirm protected profiles up front,
+	// with the same planned changes a single upload shows
+	if !opts.DryRun {
+		for _, name := range names {
+			profile, err := cfg.GetProfile(name)
+			if err != nil || !profile.Protected || opts.Yes {
+				continue // Errors are reported by the target itself
+			}
+			summary, err := planUpSummary(profile, target, opts)
+			if err != nil {
+				notify.Error("SFTP Error", err.Error())
+				fmt.Fprintf(os.Stderr, "✗ %s: Failed to plan upload: %v\n", name, err)
+				return err
+			}
+			if err := confirmProtected(name, profile, summary, opts.Yes); err != nil {
+				notify.Error("SFTP Sync Error", err.Error())
+				return err
+			}
+		}
+		opts.Yes = true
+	}
+
+	return runTargets("Upload", names, opts, func(name string, r *reporter) (int, error) {
+		return upProfile(cfg, name, target, opts, r)
+	})
+}
+
+// planUpSummary plans an upload to a profile and returns the summary its
+// confirmation shows (see upSummary and releaseSummary)
+func planUpSummary(profile *config.Profile, target string, opts SyncOptions) ([]string, error) {
+	contextDir, err := getContext(profile, target)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Context == "" {
+		profile.Context = contextDir
+	}
+
+	targets, err := resolveTargets(profile, target, false)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Release && len(targets) == 1 {
+		return releaseSummary(profile, targets[0]), nil
+	}
+
+	plans := make([][]lftp.Operation, len(targets))
+	for i, t := range targets {
+		if plans[i], err = lftp.PlanUp(t.profile, t.subdir); err != nil {
+			return nil, err
+		}
+	}
+	return upSummary(profile, targets, plans), nil
+}
+
+// upSummary describes the planned changes of an upload for confirmations
+func upSummary(profile *config.Profile, targets []syncTarget, plans [][]lftp.Operation) []string {
+	summary := []string{fmt.Sprintf("Upload to %s: %s", profile.Host, summarizeOperations(plans...))}
+	for _, t := range targets {
+		summary = append(summary, t.label())
+	}
+	return summary
+}
+
+// releaseSummary describes a release deploy for confirmations
+func releaseSummary(profile *config.Profile, t syncTarget) []string {
+	return []string{fmt.Sprintf("Deploy a new release to %s:%s", profile.Host, t.profile.RemotePath)}
+}
+
+// upProfile uploads to a single profile and returns the number of files synced
+func upProfile(cfg *config.Config, profileName, target string, opts SyncOptions, r *reporter) (fileCount int, err error) {
+	// Get profile
+	profile, err := cfg.GetProfile(profileName)
+	if err != nil {
+		r.Error("SFTP Sync Error", err.Error())
+		return 0, err
+	}
+
+	// Read-only profiles never upload
+	if err := profile.CheckWritable(); err != nil {
+		r.Error("SFTP Sync Error", err.Error())
+		r.Errorf("✗ %s: %v\n", profileName, err)
+		return 0, err
+	}
+
 	// Get context directory (respects config, falls back to smart detection)
-	contextDir, err := getContext(profile, contextFile)
+	contextDir, err := getContext(profile, target)
 	if err != nil {
-		notify.Error("SFTP Error", err.Error())
-		return err
+		r.Error("SFTP Error", err.Error())
+		return 0, err
 	}
 
 	// Set the resolved context (only if it wasn't already set from config)
@@ -88,38 +318,143 @@ func Up(profileName, contextFile string) error {
 		profile.Context = contextDir
 	}
 
-	notify.Info("SFTP Sync", fmt.Sprintf("Uploading to %s...", profile.Host))
+	// Work out which mappings (or which directory of one) to sync
+	targets, err := resolveTargets(profile, target, false)
+	if err != nil {
+		r.Error("SFTP Error", err.Error())
+		return 0, err
+	}
+
+	if opts.Release && (len(targets) != 1 || targets[0].subdir != "") {
+		err := fmt.Errorf("release deploys upload a single mapping as a whole")
+		r.Error("SFTP Error", err.Error())
+		return 0, err
+	}
+
+	if opts.DryRun {
+		return planUp(profile, targets, opts, r)
+	}
 
-	// Perform sync
-	result, err := lftp.SyncUp(profile)
+	// Only one sftp-sync process changes a profile at a time
+	l, err := lock.Acquire(profileName, "up", opts.Wait)
 	if err != nil {
-		notify.Error("SFTP Error", err.Error())
-		return err
+		r.Error("SFTP Sync Error", err.Error())
+		r.Errorf("✗ %s: %v\n", profileName, err)
+		return 0, err
+	}
+	defer l.Release()
+
+	// Record the upload in the history log once it's done
+	start := time.Now()
+	entry := history.Entry{
+		Profile:   profileName,
+		Direction: history.DirectionUp,
+		GitCommit: history.GitCommit(profile.Context),
+	}
+	defer func() {
+		entry.FileCount = fileCount
+		recordHistory(entry, start, err)
+	}()
+
+	if opts.Release {
+		// A release built from an empty directory would take the site down when it goes live
+		if !opts.Force {
+			if files, err := lftp.ListLocal(targets[0].profile, "", syncignore.Up); err == nil && len(files) == 0 {
+				err := fmt.Errorf("refusing to deploy: %s is empty", targets[0].profile.Context)
+				r.Error("SFTP Sync Refused", err.Error())
+				r.Errorf("✗ %v (run with --force if this is intended)\n", err)
+				return 0, err
+			}
+		}
+		if err := confirmProtected(profileName, profile, releaseSummary(profile, targets[0]), opts.Yes); err != nil {
+			r.Error("SFTP Sync Error", err.Error())
+			return 0, err
+		}
+		deployment, err := upRelease(targets[0].profile, r)
+		if deployment != nil {
+			entry.Release = deployment.Release
+			if deployment.Result != nil {
+				fileCount = deployment.Result.FileCount
+				entry.Files = deployment.Result.Files
+				entry.Bytes = deployment.Result.Bytes
+			}
+		}
+		return fileCount, err
+	}
+
+	r.Info("SFTP Sync", fmt.Sprintf("Uploading to %s%s...", profile.Host, targetsSuffix(targets)))
+
+	// Plan every mapping first so a dangerous sync is refused before anything changes
+	plans := make([][]lftp.Operation, len(targets))
+	for i, t := range targets {
+		ops, err := lftp.PlanUp(t.profile, t.subdir)
+		if err != nil {
+			r.Error("SFTP Error", err.Error())
+			r.Errorf("✗ Failed to plan upload: %v\n", err)
+			return 0, err
+		}
+		if !opts.Force {
+			if err := checkDeletions(t, ops, false, r); err != nil {
+				r.Error("SFTP Sync Refused", err.Error())
+				return 0, err
+			}
+		}
+		plans[i] = ops
+	}
+
+	if err := confirmProtected(profileName, profile, upSummary(profile, targets, plans), opts.Yes); err != nil {
+		r.Error("SFTP Sync Error", err.Error())
+		return 0, err
+	}
+
+	for i, t := range targets {
+		// Save remote files that are about to be overwritten or deleted
+		if err := backupBeforeUp(profileName, t.profile, t.subdir, plans[i], r); err != nil {
+			r.Error("SFTP Error", err.Error())
+			r.Errorf("✗ %v\n", err)
+			return fileCount, err
+		}
+
+		// Perform sync
+		result, err := lftp.SyncUp(t.profile, t.subdir)
+		if err != nil {
+			r.Error("SFTP Error", err.Error())
+			return fileCount, err
+		}
+
+		// Handle errors
+		if !result.Success {
+			r.Error("SFTP Error", fmt.Sprintf("Upload failed: %s", result.ErrorMessage))
+			r.Errorf("✗ Upload failed!\n")
+			if len(targets) > 1 {
+				r.Errorf("✗ Mapping: %s\n", t.label())
+			}
+			r.Errorf("✗ Error: %s\n", result.ErrorMessage)
+			return fileCount, fmt.Errorf("upload failed: %s", result.ErrorMessage)
+		}
+
+		printOperations(r, result.Operations, remoteRoot(t))
+		recordSyncState(profileName, t, syncignore.Up, r)
+		if len(targets) > 1 {
+			r.Printf("  %s: %d files synced\n", t.label(), result.FileCount)
+		}
+		fileCount += result.FileCount
+		entry.Bytes += result.Bytes
+		for _, f := range result.Files {
+			entry.Files = append(entry.Files, path.Join(remoteRoot(t), f))
+		}
 	}
 
 	// Handle result
-	if result.Success {
-		if result.HasFtpQuota {
-			msg := fmt.Sprintf("Uploaded to %s\nFiles synced: %d\n(Warning: .ftpquota protected)", profile.Host, result.FileCount)
-			notify.Warning("SFTP Sync Complete", msg)
-			fmt.Printf("⚠ Upload complete: %d files synced (Warning: .ftpquota is server-protected)\n", result.FileCount)
-		} else {
-			msg := fmt.Sprintf("Uploaded to %s\nFiles synced: %d", profile.Host, result.FileCount)
-			notify.Success("SFTP Sync Complete", msg)
-			fmt.Printf("✓ Upload complete: %d files synced\n", result.FileCount)
-		}
-		return nil
-	}
-
-	// Handle errors
-	notify.Error("SFTP Error", fmt.Sprintf("Upload failed: %s", result.ErrorMessage))
-	fmt.Fprintf(os.Stderr, "✗ Upload failed!\n")
-	fmt.Fprintf(os.Stderr, "✗ Error: %s\n", result.ErrorMessage)
-	return fmt.Errorf("upload failed: %s", result.ErrorMessage)
+	msg := fmt.Sprintf("Uploaded to %s\nFiles synced: %d", profile.Host, fileCount)
+	r.Success("SFTP Sync Complete", msg)
+	r.Printf("✓ Upload complete: %d files synced\n", fileCount)
+	return fileCount, nil
 }
 
-// Down performs full download sync
-func Down(profileName, contextFile string) error {
+// Down performs full download sync.
+// target is an optional file (for context detection) or a directory to sync on its own.
+func Down(profileName, target string, opts SyncOptions) (err error) {
 	// Check dependencies
 	if err := deps.CheckRequired("lftp", "notify-send"); err != nil {
 		notify.Error("SFTP Sync Error", err.Error())
@@ -141,7 +476,7 @@ func Down(profileName, contextFile string) error {
 	}
 
 	// Get context directory (respects config, falls back to smart detection)
-	contextDir, err := getContext(profile, contextFile)
+	contextDir, err := getContext(profile, target)
 	if err != nil {
 		notify.Error("SFTP Error", err.Error())
 		return err
@@ -152,38 +487,148 @@ func Down(profileName, contextFile string) error {
 		profile.Context = contextDir
 	}
 
-	notify.Info("SFTP Sync", fmt.Sprintf("Downloading from %s...", profile.Host))
+	// Work out which mappings (or which directory of one) to sync
+	targets, err := resolveTargets(profile, target, true)
+	if err != nil {
+		notify.Error("SFTP Error", err.Error())
+		return err
+	}
+
+	if opts.DryRun {
+		return planDown(targets, defaultReporter)
+	}
 
-	// Perform sync
-	result, err := lftp.SyncDown(profile)
+	// Only one sftp-sync process changes a profile at a time
+	l, err := lock.Acquire(profileName, "down", opts.Wait)
 	if err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", profileName, err)
+		return err
+	}
+	defer l.Release()
+
+	// Downloads into a git working tree are checked against uncommitted changes
+	repo := gitrepo.Open(profile.Context)
+	if repo == nil && opts.CommitTo != "" {
+		err := fmt.Errorf("--commit-to requires the context to be in a git repository")
 		notify.Error("SFTP Error", err.Error())
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		return err
+	}
+
+	// Record the download in the history log once it's done
+	start := time.Now()
+	entry := history.Entry{
+		Profile:   profileName,
+		Direction: history.DirectionDown,
+	}
+	fileCount := 0
+	defer func() {
+		entry.FileCount = fileCount
+		recordHistory(entry, start, err)
+	}()
+
+	notify.Info("SFTP Sync", fmt.Sprintf("Downloading from %s%s...", profile.Host, targetsSuffix(targets)))
+
+	// Plan every mapping first so a dangerous sync is refused before anything changes
+	plans := make([][]lftp.Operation, len(targets))
+	for i, t := range targets {
+		ops, err := lftp.PlanDown(t.profile, t.subdir)
+		if err != nil {
+			notify.Error("SFTP Error", err.Error())
+			fmt.Fprintf(os.Stderr, "✗ Failed to plan download: %v\n", err)
+			return err
+		}
+		if !opts.Force {
+			if err := checkDeletions(t, ops, true, defaultReporter); err != nil {
+				notify.Error("SFTP Sync Refused", err.Error())
+				return err
+			}
+		}
+		plans[i] = ops
+	}
+
+	summary := []string{fmt.Sprintf("Download from %s (deletes local files missing on the server): %s", profile.Host, summarizeOperations(plans...))}
+	for _, t := range targets {
+		summary = append(summary, t.label())
+	}
+	if err := confirmProtected(profileName, profile, summary, opts.Yes); err != nil {
+		notify.Error("SFTP Sync Error", err.Error())
 		return err
 	}
 
+	// Don't silently discard uncommitted local work
+	if repo != nil {
+		if err := protectWorkingTree(profileName, profile, repo, targets, plans, opts); err != nil {
+			notify.Error("SFTP Sync Refused", err.Error())
+			return err
+		}
+	}
+
+	// Keep a running daemon from uploading what this download writes
+	var roots []string
+	for _, t := range targets {
+		roots = append(roots, filepath.Join(t.profile.Context, t.subdir))
+	}
+	if done, err := syncstate.Expect(profileName, roots...); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		defer done()
+	}
+
+	for i, t := range targets {
+		// Save local files that are about to be overwritten or deleted
+		if err := backupBeforeDown(profileName, t.profile, t.subdir, plans[i], defaultReporter); err != nil {
+			notify.Error("SFTP Error", err.Error())
+			fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+			return err
+		}
+
+		// Perform sync
+		result, err := lftp.SyncDown(t.profile, t.subdir)
+		if err != nil {
+			notify.Error("SFTP Error", err.Error())
+			return err
+		}
+
+		// Handle errors
+		if !result.Success {
+			notify.Error("SFTP Error", fmt.Sprintf("Download failed: %s", result.ErrorMessage))
+			fmt.Fprintf(os.Stderr, "✗ Download failed!\n")
+			if len(targets) > 1 {
+				fmt.Fprintf(os.Stderr, "✗ Mapping: %s\n", t.label())
+			}
+			fmt.Fprintf(os.Stderr, "✗ Error: %s\n", result.ErrorMessage)
+			return fmt.Errorf("download failed: %s", result.ErrorMessage)
+		}
+
+		if root, err := localRoot(t); err == nil {
+			printOperations(defaultReporter, result.Operations, root)
+		}
+		recordSyncState(profileName, t, syncignore.Down, defaultReporter)
+		if len(targets) > 1 {
+			fmt.Printf("  %s: %d files synced\n", t.label(), result.FileCount)
+		}
+		fileCount += result.FileCount
+		entry.Bytes += result.Bytes
+		for _, f := range result.Files {
+			entry.Files = append(entry.Files, filepath.Join(t.profile.Context, t.subdir, f))
+		}
+	}
+
 	// Handle result
-	if result.Success {
-		if result.HasFtpQuota {
-			msg := fmt.Sprintf("Downloaded from %s\nFiles synced: %d\n(Warning: .ftpquota protected)", profile.Host, result.FileCount)
-			notify.Warning("SFTP Sync Complete", msg)
-			fmt.Printf("⚠ Download complete: %d files synced (Warning: .ftpquota is server-protected)\n", result.FileCount)
-		} else {
-			msg := fmt.Sprintf("Downloaded from %s\nFiles synced: %d", profile.Host, result.FileCount)
-			notify.Success("SFTP Sync Complete", msg)
-			fmt.Printf("✓ Download complete: %d files synced\n", result.FileCount)
-		}
-		return nil
-	}
-
-	// Handle errors
-	notify.Error("SFTP Error", fmt.Sprintf("Download failed: %s", result.ErrorMessage))
-	fmt.Fprintf(os.Stderr, "✗ Download failed!\n")
-	fmt.Fprintf(os.Stderr, "✗ Error: %s\n", result.ErrorMessage)
-	return fmt.Errorf("download failed: %s", result.ErrorMessage)
+	msg := fmt.Sprintf("Downloaded from %s\nFiles synced: %d", profile.Host, fileCount)
+	notify.Success("SFTP Sync Complete", msg)
+	fmt.Printf("✓ Download complete: %d files synced\n", fileCount)
+
+	if repo != nil {
+		return reportGitChanges(profileName, profile, repo, targets, opts)
+	}
+	return nil
 }
 
 // Diff shows what would be uploaded (dry-run)
-func Diff(profileName, contextFile string) error {
+func Diff(profileName, target string) error {
 	// Check dependencies
 	if err := deps.CheckRequired("lftp", "notify-send"); err != nil {
 		notify.Error("SFTP Sync Error", err.Error())
@@ -205,7 +650,7 @@ func Diff(profileName, contextFile string) error {
 	}
 
 	// Get context directory (respects config, falls back to smart detection)
-	contextDir, err := getContext(profile, contextFile)
+	contextDir, err := getContext(profile, target)
 	if err != nil {
 		notify.Error("SFTP Error", err.Error())
 		return err
@@ -216,11 +661,23 @@ func Diff(profileName, contextFile string) error {
 		profile.Context = contextDir
 	}
 
+	// Work out which mappings (or which directory of one) to compare
+	targets, err := resolveTargets(profile, target, false)
+	if err != nil {
+		notify.Error("SFTP Error", err.Error())
+		return err
+	}
+
 	notify.Info("SFTP Sync", "Comparing local vs remote...")
 
-	if err := lftp.Diff(profile); err != nil {
-		notify.Error("SFTP Error", "Diff failed")
-		return err
+	for _, t := range targets {
+		if len(targets) > 1 {
+			fmt.Printf("== %s\n", t.label())
+		}
+		if err := lftp.Diff(t.profile, t.subdir); err != nil {
+			notify.Error("SFTP Error", "Diff failed")
+			return err
+		}
 	}
 
 	notify.Success("SFTP Diff Complete", "Check terminal for differences")
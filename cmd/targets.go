@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"sftp-sync/internal/notify"
+)
+
+// DefaultConcurrency is how many profiles a multi-target run syncs at once
+const DefaultConcurrency = 4
+
+// targetResult is the outcome of one profile in a multi-target run
+type targetResult struct {
+	name    string
+	files   int
+	err     error
+	skipped bool // Not started because of --fail-fast
+}
+
+// runTargets runs fn for every profile concurrently (bounded by opts.Concurrency),
+// then prints one summary and sends one notification. A failing target doesn't
+// stop the others unless opts.FailFast is set, in which case targets that
+// haven't started yet are skipped.
+func runTargets(action string, names []string, opts SyncOptions, fn func(name string, r *reporter) (int, error)) error {
+	limit := opts.Concurrency
+	if limit <= 0 {
+		limit = DefaultConcurrency
+	}
+
+	if !opts.DryRun {
+		notify.Info("SFTP Sync", fmt.Sprintf("%s: %d targets (%s)...", action, len(names), strings.Join(names, ", ")))
+	}
+
+	results := make([]targetResult, len(names))
+	semaphore := make(chan struct{}, limit)
+	var failed bool
+	var failedMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			failedMu.Lock()
+			skip := opts.FailFast && failed
+			failedMu.Unlock()
+			if skip {
+				results[i] = targetResult{name: name, skipped: true}
+				return
+			}
+
+			files, err := fn(name, targetReporter(name))
+			results[i] = targetResult{name: name, files: files, err: err}
+
+			if err != nil {
+				failedMu.Lock()
+				failed = true
+				failedMu.Unlock()
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	// Aggregated summary
+	succeeded, failures, skipped, totalFiles := 0, 0, 0, 0
+	counted := "files synced"
+	if opts.DryRun {
+		counted = "operations planned"
+	}
+	fmt.Printf("\n%s summary:\n", action)
+	for _, res := range results {
+		switch {
+		case res.skipped:
+			skipped++
+			fmt.Printf("  - %s: skipped (--fail-fast)\n", res.name)
+		case res.err != nil:
+			failures++
+			fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n", res.name, res.err)
+		default:
+			succeeded++
+			totalFiles += res.files
+			fmt.Printf("  ✓ %s: %d %s\n", res.name, res.files, counted)
+		}
+	}
+
+	summary := fmt.Sprintf("%d succeeded, %d failed", succeeded, failures)
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+
+	if failures > 0 || skipped > 0 {
+		notify.Error(fmt.Sprintf("SFTP %s Failed", action), fmt.Sprintf("%s\nFiles synced: %d", summary, totalFiles))
+		fmt.Fprintf(os.Stderr, "✗ %s: %s\n", action, summary)
+		return fmt.Errorf("%s failed for %d of %d targets", strings.ToLower(action), failures+skipped, len(names))
+	}
+
+	if opts.DryRun {
+		fmt.Printf("✓ %s dry run: %s, %d %s, no changes made\n", action, summary, totalFiles, counted)
+		return nil
+	}
+
+	notify.Success(fmt.Sprintf("SFTP %s Complete", action), fmt.Sprintf("%s\nFiles synced: %d", summary, totalFiles))
+	fmt.Printf("✓ %s complete: %s, %d files synced\n", action, summary, totalFiles)
+	return nil
+}
@@ -2,9 +2,6 @@ module sftp-sync
 
 go 1.25.5
 
-require (
-	github.com/bmatcuk/doublestar/v4 v4.9.1
-	github.com/fsnotify/fsnotify v1.9.0
-)
+require github.com/fsnotify/fsnotify v1.9.0
 
 require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,389 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/state"
+)
+
+// Which side of the sync a snapshot's files were taken from
+const (
+	SideRemote = "remote"
+	SideLocal  = "local"
+)
+
+const (
+	manifestFile = "manifest.json"
+	filesDir     = "files"
+	idFormat     = "20060102-150405"
+)
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrNothingToRestore = errors.New("no files in snapshot match")
+)
+
+// Snapshot is a set of files saved before a sync overwrote or deleted them
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Profile   string    `json:"profile"`
+	Operation string    `json:"operation"` // up, down, push, pull, daemon
+	Side      string    `json:"side"`      // remote or local
+	Root      string    `json:"root"`      // remote path or context the files belong to
+	Created   time.Time `json:"created"`
+	Files     []string  `json:"files"` // absolute paths on Side
+
+	dir string
+}
+
+// profileDir returns the backup directory for a profile
+func profileDir(profileName string) (string, error) {
+	dir, err := state.Path("backups", profileName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("cannot create backup directory: %w", err)
+	}
+	return dir, nil
+}
+
+// newSnapshot creates an empty snapshot directory with a unique ID
+func newSnapshot(profileName, operation, side, root string) (*Snapshot, error) {
+	base, err := profileDir(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	id := now.Format(idFormat)
+	for n := 2; ; n++ {
+		dir := filepath.Join(base, id)
+		if err := os.Mkdir(dir, 0700); err == nil {
+			return &Snapshot{
+				ID:        id,
+				Profile:   profileName,
+				Operation: operation,
+				Side:      side,
+				Root:      root,
+				Created:   now,
+				dir:       dir,
+			}, nil
+		} else if !os.IsExist(err) {
+			return nil, fmt.Errorf("cannot create snapshot: %w", err)
+		}
+		id = fmt.Sprintf("%s-%d", now.Format(idFormat), n)
+	}
+}
+
+// storedPath returns where a file from the snapshot's side is kept in the store
+func (s *Snapshot) storedPath(p string) string {
+	return filepath.Join(s.dir, filesDir, p)
+}
+
+// finish records which files were captured, writes the manifest and prunes old snapshots.
+// Empty snapshots are discarded and nil is returned.
+func (s *Snapshot) finish(keep int) (*Snapshot, error) {
+	root := filepath.Join(s.dir, filesDir)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			s.Files = append(s.Files, "/"+strings.TrimPrefix(p, root+"/"))
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(s.dir)
+		return nil, fmt.Errorf("cannot read snapshot: %w", err)
+	}
+
+	if len(s.Files) == 0 {
+		os.RemoveAll(s.dir)
+		return nil, nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, manifestFile), data, 0600); err != nil {
+		os.RemoveAll(s.dir)
+		return nil, fmt.Errorf("cannot write snapshot manifest: %w", err)
+	}
+
+	if err := prune(s.Profile, keep); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to prune old backups: %v\n", err)
+	}
+
+	return s, nil
+}
+
+// Remote saves the current remote versions of files and directories before
+// they are overwritten or deleted. Paths are absolute remote paths; paths that
+// don't exist on the remote are skipped. Returns nil if nothing was saved.
+func Remote(profileName string, profile *config.Profile, operation string, files, dirs []string) (*Snapshot, error) {
+	if profile.DisableBackups || (len(files) == 0 && len(dirs) == 0) {
+		return nil, nil
+	}
+
+	s, err := newSnapshot(profileName, operation, SideRemote, profile.RemotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make(map[string]string)
+	for _, remote := range files {
+		transfers[remote] = s.storedPath(remote)
+	}
+	if err := lftp.DownloadFiles(profile, transfers); err != nil {
+		os.RemoveAll(s.dir)
+		return nil, err
+	}
+
+	for _, remote := range dirs {
+		if err := lftp.DownloadDir(profile, remote, s.storedPath(remote)); err != nil {
+			os.RemoveAll(s.dir)
+			return nil, err
+		}
+	}
+
+	return s.finish(profile.BackupKeep)
+}
+
+// Local saves local files and directories before they are overwritten or deleted.
+// Paths are absolute local paths; paths that don't exist are skipped.
+// Returns nil if nothing was saved.
+func Local(profileName string, profile *config.Profile, operation string, paths []string) (*Snapshot, error) {
+	if profile.DisableBackups || len(paths) == 0 {
+		return nil, nil
+	}
+
+	s, err := newSnapshot(profileName, operation, SideLocal, profile.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range paths {
+		if err := copyTree(p, s.storedPath(p)); err != nil {
+			os.RemoveAll(s.dir)
+			return nil, err
+		}
+	}
+
+	return s.finish(profile.BackupKeep)
+}
+
+// List returns all snapshots for a profile, oldest first
+func List(profileName string) ([]*Snapshot, error) {
+	base, err := profileDir(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		s, err := load(filepath.Join(base, entry.Name()))
+		if err != nil {
+			// Incomplete snapshot (e.g. interrupted backup) - skip
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	return snapshots, nil
+}
+
+// Find returns a snapshot by ID
+func Find(profileName, id string) (*Snapshot, error) {
+	base, err := profileDir(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := load(filepath.Join(base, filepath.Base(id)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return s, nil
+}
+
+// load reads a snapshot manifest from its directory
+func load(dir string) (*Snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	s.dir = dir
+	return &s, nil
+}
+
+// Match returns the snapshot files selected by filter.
+// filter may be empty (all files), an absolute path, or a path relative to
+// the snapshot root; directories select everything beneath them.
+func (s *Snapshot) Match(filter string) []string {
+	if filter == "" {
+		return s.Files
+	}
+
+	target := filter
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(s.Root, target)
+	}
+	target = filepath.Clean(target)
+
+	var matched []string
+	for _, f := range s.Files {
+		if f == target || strings.HasPrefix(f, target+"/") {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
+// PlanRestore returns the operations Restore would perform, without changing
+// anything. Paths are absolute.
+func PlanRestore(s *Snapshot, filter string) ([]lftp.Operation, error) {
+	files := s.Match(filter)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNothingToRestore, filter)
+	}
+
+	action := lftp.ActionUpload
+	if s.Side == SideLocal {
+		action = lftp.ActionCopy
+	}
+
+	ops := make([]lftp.Operation, 0, len(files))
+	for _, f := range files {
+		ops = append(ops, lftp.Operation{Action: action, Path: f})
+	}
+	return ops, nil
+}
+
+// Restore puts the snapshot's files back where they were taken from.
+// Returns the restored paths.
+func Restore(profile *config.Profile, s *Snapshot, filter string) ([]string, error) {
+	files := s.Match(filter)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNothingToRestore, filter)
+	}
+
+	if s.Side == SideRemote {
+		transfers := make(map[string]string)
+		for _, f := range files {
+			transfers[s.storedPath(f)] = f
+		}
+		if err := lftp.UploadFiles(profile, transfers); err != nil {
+			return nil, err
+		}
+		return files, nil
+	}
+
+	for _, f := range files {
+		if err := copyTree(s.storedPath(f), f); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// prune removes the oldest snapshots beyond keep
+func prune(profileName string, keep int) error {
+	snapshots, err := List(profileName)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) <= keep {
+		return nil
+	}
+
+	for _, s := range snapshots[:len(snapshots)-keep] {
+		if err := os.RemoveAll(s.dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies a file or directory tree, preserving permissions and modification times.
+// Missing sources are skipped.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		target := filepath.Join(dst, strings.TrimPrefix(p, src))
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			// Symlinks are not synced - nothing to back up
+			return nil
+		default:
+			return copyFile(p, target, info)
+		}
+	})
+}
+
+// copyFile copies a single regular file
+func copyFile(src, dst string, info os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("cannot create directory: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
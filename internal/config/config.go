@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var (
@@ -21,11 +22,25 @@ var (
 	ErrInvalidProtocol      = errors.New("invalid protocol: must be 'ftp' or 'sftp'")
 	ErrInvalidPort          = errors.New("invalid port: must be between 1 and 65535")
 	ErrProfileNotFound      = errors.New("profile not found in config")
+	ErrInvalidReleaseKeep   = errors.New("invalid releaseKeep: must be at least 1")
+	ErrInvalidBackupKeep    = errors.New("invalid backupKeep: must be at least 1")
+	ErrInvalidMapping       = errors.New("invalid mapping: local and remote are required")
+	ErrGroupNameTaken       = errors.New("group name is already used by a profile")
+	ErrEmptyGroup           = errors.New("group has no profiles")
+	ErrProtectedAutoSync    = errors.New("autoSync is disabled for protected profiles (set allowProtectedAutoSync to enable it)")
+	ErrReadOnlyProfile      = errors.New("profile is read-only: remote changes are not allowed")
+	ErrInvalidWatchMode     = errors.New("invalid watchMode: must be 'inotify', 'poll' or 'auto'")
+	ErrInvalidPollInterval  = errors.New("invalid pollInterval: must be at least 1 second")
+	ErrInvalidDownInterval  = errors.New("invalid autoSyncDownInterval: must be at least 1 second")
+	ErrInvalidDeleteLimit   = errors.New("invalid deleteLimit: must be 0 or more, or -1 for no limit")
+	ErrInvalidDeletePercent = errors.New("invalid deleteLimitPercent: must be between 0 and 100, or -1 for no limit")
 )
 
 const (
 	DefaultConfigDir  = ".config/sftp-sync"
 	DefaultConfigFile = "config.json"
+	DefaultIgnoreFile = "ignore" // user-global ignore patterns, next to the config file
+	GroupsKey         = "groups" // reserved top-level key for profile groups
 )
 
 // GetConfigPath returns the full path to the config file
@@ -37,6 +52,15 @@ func GetConfigPath() (string, error) {
 	return filepath.Join(home, DefaultConfigDir, DefaultConfigFile), nil
 }
 
+// GetGlobalIgnorePath returns the full path to the user-global ignore file
+func GetGlobalIgnorePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, DefaultConfigDir, DefaultIgnoreFile), nil
+}
+
 // Load reads and parses the configuration file
 func Load() (*Config, error) {
 	configPath, err := GetConfigPath()
@@ -62,14 +86,30 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("%w: %s", ErrConfigEmpty, configPath)
 	}
 
-	// Parse JSON
-	var profiles map[string]Profile
-	if err := json.Unmarshal(data, &profiles); err != nil {
+	// Parse JSON - top-level keys are profiles, except the reserved "groups" key
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidJSON, err)
 	}
 
 	config := &Config{
-		Profiles: profiles,
+		Profiles: make(map[string]Profile),
+		Groups:   make(map[string][]string),
+	}
+
+	for name, raw := range entries {
+		if name == GroupsKey {
+			if err := json.Unmarshal(raw, &config.Groups); err != nil {
+				return nil, fmt.Errorf("%w: groups: %s", ErrInvalidJSON, err)
+			}
+			continue
+		}
+
+		var profile Profile
+		if err := json.Unmarshal(raw, &profile); err != nil {
+			return nil, fmt.Errorf("%w: profile '%s': %s", ErrInvalidJSON, name, err)
+		}
+		config.Profiles[name] = profile
 	}
 
 	// Validate and set defaults for each profile
@@ -82,9 +122,60 @@ func Load() (*Config, error) {
 		config.Profiles[name] = profile
 	}
 
+	// Validate groups
+	for name, members := range config.Groups {
+		if _, exists := config.Profiles[name]; exists {
+			return nil, fmt.Errorf("group '%s': %w", name, ErrGroupNameTaken)
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("group '%s': %w", name, ErrEmptyGroup)
+		}
+		for _, member := range members {
+			if _, exists := config.Profiles[member]; !exists {
+				return nil, fmt.Errorf("group '%s': %w: '%s'", name, ErrProfileNotFound, member)
+			}
+		}
+	}
+
 	return config, nil
 }
 
+// ResolveTargets expands a target spec into profile names.
+// The spec is a profile name, a group name, or a comma-separated list of either.
+// Duplicates are removed; order is preserved.
+func (c *Config) ResolveTargets(spec string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if members, isGroup := c.Groups[part]; isGroup {
+			for _, member := range members {
+				add(member)
+			}
+			continue
+		}
+		if _, exists := c.Profiles[part]; !exists {
+			return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, part)
+		}
+		add(part)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, spec)
+	}
+	return names, nil
+}
+
 // GetProfile retrieves a profile by name
 func (c *Config) GetProfile(name string) (*Profile, error) {
 	profile, exists := c.Profiles[name]
@@ -1,22 +1,103 @@
 package config
 
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mapping pairs a local directory with the remote directory it syncs to
+type Mapping struct {
+	Local  string   `json:"local"`  // local directory (relative paths are relative to context)
+	Remote string   `json:"remote"` // remote directory
+	Ignore []string `json:"ignore"` // extra ignore patterns for this mapping
+}
+
+// Watch modes of the auto-sync daemon
+const (
+	WatchInotify = "inotify" // inotify watches on every directory
+	WatchPoll    = "poll"    // scan modification times and sizes on an interval
+	WatchAuto    = "auto"    // inotify, falling back to polling where it can't work
+)
+
 // Profile represents a single server configuration
 type Profile struct {
-	Host              string `json:"host"`
-	Username          string `json:"username"`
-	Password          string `json:"password"`
-	SSHKey            string `json:"sshKey"`
-	Port              int    `json:"port"`
-	Protocol          string `json:"protocol"`
-	RemotePath        string `json:"remotePath"`
-	Context           string `json:"context"`
-	AutoSync          bool   `json:"autoSync"`
-	AutoSyncDebounce  int    `json:"autoSyncDebounce"` // milliseconds
+	Host                   string    `json:"host"`
+	Username               string    `json:"username"`
+	Password               string    `json:"password"`
+	SSHKey                 string    `json:"sshKey"`
+	Port                   int       `json:"port"`
+	Protocol               string    `json:"protocol"`
+	RemotePath             string    `json:"remotePath"`
+	Context                string    `json:"context"`
+	AutoSync               bool      `json:"autoSync"`
+	AutoSyncDebounce       int       `json:"autoSyncDebounce"`       // milliseconds
+	AutoSyncDelete         bool      `json:"autoSyncDelete"`         // let the daemon delete and rename remote files when local ones are
+	AutoSyncDown           bool      `json:"autoSyncDown"`           // let the daemon download files changed on the remote
+	AutoSyncDownInterval   int       `json:"autoSyncDownInterval"`   // seconds between remote checks
+	WatchMode              string    `json:"watchMode"`              // how the daemon notices changes: inotify, poll or auto
+	PollInterval           int       `json:"pollInterval"`           // seconds between scans in poll mode
+	ReleaseKeep            int       `json:"releaseKeep"`            // number of releases to keep for up --release
+	ReleaseCopyPrevious    bool      `json:"releaseCopyPrevious"`    // seed new releases from the live one
+	DisableBackups         bool      `json:"disableBackups"`         // don't back up files before overwriting them
+	BackupKeep             int       `json:"backupKeep"`             // number of backup snapshots to keep
+	Mappings               []Mapping `json:"mappings"`               // local <-> remote directory pairs (default: context <-> remotePath)
+	DeleteLimit            *int      `json:"deleteLimit"`            // max files up/down may delete without --force (-1: no limit)
+	DeleteLimitPercent     *int      `json:"deleteLimitPercent"`     // max percentage of destination files up/down may delete without --force (-1: no limit)
+	Protected              bool      `json:"protected"`              // require typed confirmation (or --yes) before changing this profile
+	Environment            string    `json:"environment"`            // label such as "production", shown in confirmations
+	AllowProtectedAutoSync bool      `json:"allowProtectedAutoSync"` // let the daemon auto-sync a protected profile
+	ReadOnly               bool      `json:"readOnly"`               // forbid every remote write (downloads and read-only mounts only)
+	Protect                []string  `json:"protect"`                // remote paths uploads never delete or overwrite (glob patterns)
+	UseGitignore           bool      `json:"useGitignore"`           // also honor .gitignore files and .git/info/exclude
+	Exclude                []string  `json:"exclude"`                // extra ignore patterns (.syncignore syntax)
+	Include                []string  `json:"include"`                // whitelist: only matching paths are synced (.syncignore syntax)
+
+	// MappingIgnore holds the extra ignore patterns of the mapping a scoped
+	// profile was created for (see ForMapping)
+	MappingIgnore []string `json:"-"`
+}
+
+// CheckWritable returns ErrReadOnlyProfile if the profile forbids remote writes
+func (p *Profile) CheckWritable() error {
+	if p.ReadOnly {
+		return ErrReadOnlyProfile
+	}
+	return nil
+}
+
+// CheckAutoSync returns an error if the daemon must not auto-sync (upload) this profile
+func (p *Profile) CheckAutoSync() error {
+	if err := p.CheckWritable(); err != nil {
+		return err
+	}
+	if p.Protected && !p.AllowProtectedAutoSync {
+		return ErrProtectedAutoSync
+	}
+	return nil
+}
+
+// DownloadOnly reports whether the daemon only downloads remote changes for
+// this profile: autoSyncDown is set, but autoSync isn't or uploads aren't
+// allowed (read-only or protected profiles). Downloads never change the remote.
+func (p *Profile) DownloadOnly() bool {
+	return p.AutoSyncDown && (!p.AutoSync || p.CheckAutoSync() != nil)
+}
+
+// CheckDaemon returns an error if the daemon must not watch this profile at
+// all (see CheckAutoSync and DownloadOnly)
+func (p *Profile) CheckDaemon() error {
+	if p.DownloadOnly() {
+		return nil
+	}
+	return p.CheckAutoSync()
 }
 
 // Config represents the entire configuration file
 type Config struct {
 	Profiles map[string]Profile
+	Groups   map[string][]string // group name -> profile names
 }
 
 // Validate checks if all required fields are present and valid
@@ -46,6 +127,37 @@ func (p *Profile) Validate() error {
 			return ErrMissingPassword
 		}
 	}
+	// Validate release settings
+	if p.ReleaseKeep < 1 {
+		return ErrInvalidReleaseKeep
+	}
+	// Validate mappings
+	for i, m := range p.Mappings {
+		if m.Local == "" || m.Remote == "" {
+			return fmt.Errorf("%w (mapping %d)", ErrInvalidMapping, i+1)
+		}
+	}
+	// Validate backup settings
+	if p.BackupKeep < 1 {
+		return ErrInvalidBackupKeep
+	}
+	// Validate delete limits (-1 disables them)
+	if p.DeleteLimit != nil && *p.DeleteLimit < -1 {
+		return ErrInvalidDeleteLimit
+	}
+	if p.DeleteLimitPercent != nil && (*p.DeleteLimitPercent < -1 || *p.DeleteLimitPercent > 100) {
+		return ErrInvalidDeletePercent
+	}
+	// Validate daemon settings
+	if p.WatchMode != WatchInotify && p.WatchMode != WatchPoll && p.WatchMode != WatchAuto {
+		return ErrInvalidWatchMode
+	}
+	if p.PollInterval < 1 {
+		return ErrInvalidPollInterval
+	}
+	if p.AutoSyncDownInterval < 1 {
+		return ErrInvalidDownInterval
+	}
 	// Context is now optional - only used for mount operations
 	return nil
 }
@@ -65,4 +177,93 @@ func (p *Profile) SetDefaults() {
 	if p.RemotePath == "" {
 		p.RemotePath = "/"
 	}
+	if p.ReleaseKeep == 0 {
+		p.ReleaseKeep = 5
+	}
+	if p.BackupKeep == 0 {
+		p.BackupKeep = 50
+	}
+	// Unset, not zero: a limit of 0 refuses every delete
+	if p.DeleteLimit == nil {
+		limit := 100
+		p.DeleteLimit = &limit
+	}
+	if p.DeleteLimitPercent == nil {
+		percent := 50
+		p.DeleteLimitPercent = &percent
+	}
+	if p.WatchMode == "" {
+		p.WatchMode = WatchAuto
+	}
+	if p.PollInterval == 0 {
+		p.PollInterval = 5
+	}
+	if p.AutoSyncDownInterval == 0 {
+		p.AutoSyncDownInterval = 60
+	}
+}
+
+// GetMappings returns the profile's local <-> remote mappings.
+// Without explicit mappings, context and remotePath form a single mapping.
+// Relative local paths are resolved against the context.
+func (p *Profile) GetMappings() []Mapping {
+	if len(p.Mappings) == 0 {
+		return []Mapping{{Local: p.Context, Remote: p.RemotePath}}
+	}
+
+	mappings := make([]Mapping, len(p.Mappings))
+	for i, m := range p.Mappings {
+		if !filepath.IsAbs(m.Local) && p.Context != "" {
+			m.Local = filepath.Join(p.Context, m.Local)
+		}
+		mappings[i] = m
+	}
+	return mappings
+}
+
+// ForMapping returns a copy of the profile scoped to a single mapping:
+// Context and RemotePath are the mapping's directories.
+func (p *Profile) ForMapping(m Mapping) *Profile {
+	scoped := *p
+	scoped.Context = m.Local
+	scoped.RemotePath = m.Remote
+	scoped.Mappings = nil
+	scoped.MappingIgnore = m.Ignore
+	return &scoped
+}
+
+// MappingFor returns the mapping whose local directory contains absPath.
+// If mappings are nested, the most specific one wins.
+func (p *Profile) MappingFor(absPath string) (Mapping, bool) {
+	var best Mapping
+	found := false
+	for _, m := range p.GetMappings() {
+		local := filepath.Clean(m.Local)
+		if absPath != local && !strings.HasPrefix(absPath, local+"/") {
+			continue
+		}
+		if !found || len(local) > len(filepath.Clean(best.Local)) {
+			best = m
+			found = true
+		}
+	}
+	return best, found
+}
+
+// MappingForRemote returns the mapping whose remote directory contains remotePath.
+// If mappings are nested, the most specific one wins.
+func (p *Profile) MappingForRemote(remotePath string) (Mapping, bool) {
+	var best Mapping
+	found := false
+	for _, m := range p.GetMappings() {
+		remote := path.Clean(m.Remote)
+		if remotePath != remote && !strings.HasPrefix(remotePath, strings.TrimSuffix(remote, "/")+"/") {
+			continue
+		}
+		if !found || len(remote) > len(path.Clean(best.Remote)) {
+			best = m
+			found = true
+		}
+	}
+	return best, found
 }
@@ -0,0 +1,177 @@
+package gitrepo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Repo is a git working tree
+type Repo struct {
+	Root string // Absolute path of the top-level directory
+}
+
+// Open returns the git repository containing dir, or nil if dir is not in one
+// (or git isn't installed)
+func Open(dir string) *Repo {
+	if dir == "" {
+		return nil
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil
+	}
+	return &Repo{Root: strings.TrimSpace(string(out))}
+}
+
+// git runs a git command in the repository and returns its stdout
+func (r *Repo) git(env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.Root}, args...)...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return string(out), nil
+}
+
+// GitPath returns the absolute path of a file in the git directory, such as
+// "info/exclude"
+func (r *Repo) GitPath(name string) (string, error) {
+	out, err := r.git(nil, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	p := strings.TrimSpace(out)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(r.Root, p)
+	}
+	return p, nil
+}
+
+// relPaths converts absolute paths to paths relative to the repository root
+func (r *Repo) relPaths(paths []string) []string {
+	rel := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if rp, err := filepath.Rel(r.Root, p); err == nil {
+			rel = append(rel, rp)
+		}
+	}
+	return rel
+}
+
+// Dirty returns the absolute paths of modified, staged and untracked files
+func (r *Repo) Dirty() ([]string, error) {
+	out, err := r.git(nil, "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		paths = append(paths, filepath.Join(r.Root, entry[3:]))
+		// Renames and copies are followed by their original path
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	return paths, nil
+}
+
+// Stash stashes local changes (including untracked files) to the given
+// absolute paths, leaving the rest of the working tree alone
+func (r *Repo) Stash(message string, paths []string) error {
+	args := append([]string{"stash", "push", "--include-untracked", "-m", message, "--"}, r.relPaths(paths)...)
+	_, err := r.git(nil, args...)
+	return err
+}
+
+// DiffStat returns `git diff --stat` for the given absolute paths, followed by
+// a line counting untracked files below them
+func (r *Repo) DiffStat(paths []string) (string, error) {
+	rel := r.relPaths(paths)
+	stat, err := r.git(nil, append([]string{"diff", "--stat", "--"}, rel...)...)
+	if err != nil {
+		return "", err
+	}
+
+	untracked, err := r.git(nil, append([]string{"ls-files", "--others", "--exclude-standard", "--"}, rel...)...)
+	if err != nil {
+		return "", err
+	}
+	if n := len(strings.Fields(untracked)); n > 0 {
+		stat += fmt.Sprintf(" %d new untracked file(s)\n", n)
+	}
+	return stat, nil
+}
+
+// CurrentBranch returns the checked-out branch, or "" for a detached HEAD
+func (r *Repo) CurrentBranch() string {
+	out, err := r.git(nil, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// CommitTo records the working tree state of the given absolute paths as a
+// new commit on branch, on top of HEAD's tree, without touching HEAD, the
+// index or the working tree. The branch is created from HEAD if it doesn't
+// exist. Returns the new commit.
+func (r *Repo) CommitTo(branch, message string, paths []string) (string, error) {
+	if branch == r.CurrentBranch() {
+		return "", fmt.Errorf("cannot commit to the checked-out branch '%s'", branch)
+	}
+
+	// Build the tree in a throwaway index so the real one is left alone
+	indexFile, err := os.CreateTemp("", "sftp-sync-index-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot create temporary index: %w", err)
+	}
+	indexFile.Close()
+	os.Remove(indexFile.Name()) // git wants to create it itself
+	defer os.Remove(indexFile.Name())
+	env := []string{"GIT_INDEX_FILE=" + indexFile.Name()}
+
+	parent := "HEAD"
+	if out, err := r.git(nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		parent = strings.TrimSpace(out)
+	}
+
+	if _, err := r.git(env, "read-tree", "HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := r.git(env, append([]string{"add", "-A", "--"}, r.relPaths(paths)...)...); err != nil {
+		return "", err
+	}
+	tree, err := r.git(env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	commit, err := r.git(nil, "commit-tree", strings.TrimSpace(tree), "-p", parent, "-m", message)
+	if err != nil {
+		return "", err
+	}
+	commit = strings.TrimSpace(commit)
+
+	if _, err := r.git(nil, "update-ref", "refs/heads/"+branch, commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
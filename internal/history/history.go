@@ -0,0 +1,221 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+
+	"sftp-sync/internal/state"
+)
+
+const (
+	historyFile = "history.jsonl"
+
+	maxFiles    = 1000             // Paths kept per entry; FileCount still has the total
+	maxLineSize = 16 * 1024 * 1024 // Longer lines are skipped when reading
+)
+
+// Directions recorded in the history
+const (
+	DirectionUp         = "up"
+	DirectionDown       = "down"
+	DirectionPush       = "push"
+	DirectionPull       = "pull"
+	DirectionDaemon     = "daemon"      // Daemon uploads, deletes and renames
+	DirectionDaemonDown = "daemon-down" // Daemon downloads (autoSyncDown)
+)
+
+// Entry is one recorded sync operation
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Profile    string    `json:"profile"`
+	Direction  string    `json:"direction"`
+	FileCount  int       `json:"fileCount"`
+	Files      []string  `json:"files,omitempty"`
+	Operation  string    `json:"operation,omitempty"` // Daemon entries: upload, download, delete or rename
+	OldPath    string    `json:"oldPath,omitempty"`   // Renames: the previous path
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"durationMs"`
+	GitCommit  string    `json:"gitCommit,omitempty"`
+	Release    string    `json:"release,omitempty"`
+	User       string    `json:"user"`
+	Hostname   string    `json:"hostname"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Duration returns how long the operation took
+func (e Entry) Duration() time.Duration {
+	return time.Duration(e.DurationMs) * time.Millisecond
+}
+
+// Filter selects history entries
+type Filter struct {
+	Profile   string    // Only this profile ("" for all)
+	Direction string    // Only this direction ("" for all)
+	Since     time.Time // Only entries at or after this time (zero for all)
+	Failed    bool      // Only failed operations
+	Limit     int       // Only the newest N entries (0 for all)
+}
+
+// Match reports whether an entry passes the filter (ignoring Limit)
+func (f Filter) Match(e Entry) bool {
+	if f.Profile != "" && e.Profile != f.Profile {
+		return false
+	}
+	if f.Direction != "" && e.Direction != f.Direction {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if f.Failed && e.Error == "" {
+		return false
+	}
+	return true
+}
+
+// Record appends an entry to the history file.
+// Time, user and hostname are filled in if not set.
+// Only the first maxFiles paths are kept; FileCount holds the total.
+func Record(e Entry) error {
+	if e.FileCount < len(e.Files) {
+		e.FileCount = len(e.Files)
+	}
+	if len(e.Files) > maxFiles {
+		e.Files = e.Files[:maxFiles]
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.User == "" {
+		if u, err := user.Current(); err == nil {
+			e.User = u.Username
+		}
+	}
+	if e.Hostname == "" {
+		e.Hostname, _ = os.Hostname()
+	}
+
+	path, err := state.Path(historyFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// O_APPEND writes of a single line are atomic enough for concurrent writers
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open history file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot write history file: %w", err)
+	}
+	return nil
+}
+
+// Read returns the entries matching a filter, oldest first
+func Read(filter Filter) ([]Entry, error) {
+	path, err := state.Path(historyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open history file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for lineNum := 1; ; lineNum++ {
+		line, err := readLine(reader)
+		if errors.Is(err, errLineTooLong) {
+			fmt.Fprintf(os.Stderr, "Warning: History entry on line %d is too long (skipping)\n", lineNum)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("cannot read history file: %w", err)
+		}
+
+		if line = strings.TrimSpace(line); line != "" {
+			var e Entry
+			if jsonErr := json.Unmarshal([]byte(line), &e); jsonErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Invalid history entry on line %d (skipping)\n", lineNum)
+			} else if filter.Match(e) {
+				entries = append(entries, e)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine returns the next line without its newline.
+// A line longer than maxLineSize is consumed and reported as errLineTooLong.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > maxLineSize {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong && (err == nil || err == io.EOF) {
+			return "", errLineTooLong
+		}
+		return strings.TrimSuffix(string(line), "\n"), err
+	}
+}
+
+// GitCommit returns the HEAD commit of the git repository containing dir,
+// with a "-dirty" suffix if there are uncommitted changes.
+// Returns "" if dir is not in a git repository.
+func GitCommit(dir string) string {
+	if dir == "" {
+		return ""
+	}
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	if err == nil && len(strings.TrimSpace(string(status))) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
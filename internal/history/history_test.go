@@ -0,0 +1,69 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordCapsFiles(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	files := make([]string, maxFiles+5)
+	for i := range files {
+		files[i] = fmt.Sprintf("/ctx/file%d", i)
+	}
+	if err := Record(Entry{Profile: "prod", Direction: DirectionUp, Files: files}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if got := len(entries[0].Files); got != maxFiles {
+		t.Errorf("kept %d files, want %d", got, maxFiles)
+	}
+	if got := entries[0].FileCount; got != len(files) {
+		t.Errorf("FileCount = %d, want %d", got, len(files))
+	}
+}
+
+func TestReadSkipsOversizedLines(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+
+	if err := Record(Entry{Profile: "before", Direction: DirectionUp}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "sftp-sync", historyFile)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oversized := `{"profile":"huge","files":["` + strings.Repeat("x", maxLineSize) + `"]}` + "\n"
+	if _, err := file.WriteString(oversized); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if err := Record(Entry{Profile: "after", Direction: DirectionUp}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Read(Filter{})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var profiles []string
+	for _, e := range entries {
+		profiles = append(profiles, e.Profile)
+	}
+	if got := strings.Join(profiles, ","); got != "before,after" {
+		t.Errorf("profiles = %s, want before,after", got)
+	}
+}
@@ -1,10 +1,14 @@
 package lftp
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"sftp-sync/internal/config"
@@ -15,12 +19,29 @@ import (
 type Result struct {
 	Success      bool
 	FileCount    int
+	Files        []string    // Files transferred or removed, relative to the mirror root
+	Operations   []Operation // Changes made, in the same form as a dry-run plan
+	Bytes        int64       // Bytes transferred
 	Output       string
 	Error        error
-	HasFtpQuota  bool
 	ErrorMessage string
 }
 
+// ErrProtected is returned when an upload would overwrite a protected remote path
+var ErrProtected = errors.New("path is protected on the remote")
+
+// ErrRemoteNotFound is returned when a remote path to rename doesn't exist
+var ErrRemoteNotFound = errors.New("remote path not found")
+
+var (
+	// Lines printed by `mirror --verbose` for each changed file
+	changedFilePattern = regexp.MustCompile("(?m)^(?:Transferring file|Removing old file|Removing old directory) `(.+)'\\s*$")
+	// Lines printed by `mirror --verbose` for every change
+	logPattern = regexp.MustCompile("(?m)^(Transferring file|Removing old file|Removing old directory|Making directory) `(.+)'\\s*$")
+	// Summary line printed by mirror, e.g. "12345 bytes transferred in 2 seconds"
+	bytesPattern = regexp.MustCompile(`(\d+) bytes? transferred`)
+)
+
 // buildConnection builds the lftp connection string
 func buildConnection(profile *config.Profile) string {
 	return fmt.Sprintf("%s://%s", profile.Protocol, profile.Host)
@@ -64,174 +85,439 @@ func buildCommand(profile *config.Profile, ftpCommand string) *exec.Cmd {
 	return exec.Command("lftp", args...)
 }
 
-// SyncUp uploads local directory to remote (mirror -R)
-func SyncUp(profile *config.Profile) (*Result, error) {
-	// Verify local path exists
-	absLocal, err := filepath.Abs(profile.Context)
-	if err != nil {
-		return nil, fmt.Errorf("cannot resolve local path: %w", err)
+// SyncUp uploads local directory to remote (mirror -R).
+// subdir limits the sync to a subdirectory of the context ("" for everything).
+func SyncUp(profile *config.Profile, subdir string) (*Result, error) {
+	if err := profile.CheckWritable(); err != nil {
+		return nil, err
 	}
 
-	// Load .syncignore patterns
-	patterns, err := syncignore.Load(absLocal)
+	local, remote, excludeStr, err := mirrorRoots(profile, subdir, syncignore.Up)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load .syncignore: %w", err)
+		return nil, err
 	}
 
-	// Build exclude flags
-	excludeFlags := syncignore.BuildExcludeFlags(patterns)
-	excludeStr := ""
-	if len(excludeFlags) > 0 {
-		excludeStr = " " + strings.Join(excludeFlags, " ")
-	}
-
-	ftpCmd := fmt.Sprintf("mirror -R --verbose --delete%s '%s' '%s'", excludeStr, absLocal, profile.RemotePath)
+	ftpCmd := fmt.Sprintf("mirror -R --verbose --delete%s '%s' '%s'", excludeStr, local, remote)
 	cmd := buildCommand(profile, ftpCmd)
 
 	output, err := cmd.CombinedOutput()
-	return parseResult(output, err)
+	result, err := parseResult(output, err)
+	if result != nil {
+		result.Operations = parseLog(result.Output, ActionUpload)
+	}
+	return result, err
 }
 
-// SyncDown downloads remote directory to local (mirror)
-func SyncDown(profile *config.Profile) (*Result, error) {
-	// Verify local path exists
-	absLocal, err := filepath.Abs(profile.Context)
+// SyncDown downloads remote directory to local (mirror).
+// subdir limits the sync to a subdirectory of the context ("" for everything).
+func SyncDown(profile *config.Profile, subdir string) (*Result, error) {
+	local, remote, excludeStr, err := mirrorRoots(profile, subdir, syncignore.Down)
 	if err != nil {
-		return nil, fmt.Errorf("cannot resolve local path: %w", err)
+		return nil, err
 	}
 
-	// Load .syncignore patterns
-	patterns, err := syncignore.Load(absLocal)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load .syncignore: %w", err)
+	ftpCmd := fmt.Sprintf("mirror --verbose --delete%s '%s' '%s'", excludeStr, remote, local)
+	cmd := buildCommand(profile, ftpCmd)
+
+	output, err := cmd.CombinedOutput()
+	result, err := parseResult(output, err)
+	if result != nil {
+		result.Operations = parseLog(result.Output, ActionDownload)
 	}
+	return result, err
+}
 
-	// Build exclude flags
-	excludeFlags := syncignore.BuildExcludeFlags(patterns)
-	excludeStr := ""
-	if len(excludeFlags) > 0 {
-		excludeStr = " " + strings.Join(excludeFlags, " ")
+// Diff shows what would be uploaded (dry-run)
+func Diff(profile *config.Profile, subdir string) error {
+	local, remote, excludeStr, err := mirrorRoots(profile, subdir, syncignore.Up)
+	if err != nil {
+		return err
 	}
 
-	ftpCmd := fmt.Sprintf("mirror --verbose --delete%s '%s' '%s'", excludeStr, profile.RemotePath, absLocal)
+	ftpCmd := fmt.Sprintf("mirror -R --dry-run --verbose%s '%s' '%s'", excludeStr, local, remote)
 	cmd := buildCommand(profile, ftpCmd)
 
-	output, err := cmd.CombinedOutput()
-	return parseResult(output, err)
+	cmd.Stdout = nil // Output goes directly to terminal
+	cmd.Stderr = nil
+
+	return cmd.Run()
 }
 
-// Diff shows what would be uploaded (dry-run)
-func Diff(profile *config.Profile) error {
-	// Load .syncignore patterns
-	patterns, err := syncignore.Load(profile.Context)
+// mirrorRoots resolves the local and remote directories of a mirror and
+// builds its exclude flags. subdir is relative to the context; ignore rules
+// are rebased so they keep their meaning inside the subtree.
+// Uploads also exclude protected remote paths, so they are never deleted or overwritten.
+func mirrorRoots(profile *config.Profile, subdir string, dir syncignore.Direction) (string, string, string, error) {
+	local, remote, ignore, err := mirrorScope(profile, subdir, dir)
 	if err != nil {
-		return fmt.Errorf("failed to load .syncignore: %w", err)
+		return "", "", "", err
+	}
+
+	excludeFlags := ignore.ExcludeFlags(subdir)
+
+	if dir == syncignore.Up {
+		protect, err := syncignore.ProtectForProfile(profile)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to load protect list: %w", err)
+		}
+		if subdir != "" && protect.Matches(subdir, true) {
+			return "", "", "", fmt.Errorf("%w: %s", ErrProtected, remote)
+		}
+		// Protect rules go last so they win (they have no re-includes)
+		excludeFlags = append(excludeFlags, protect.ExcludeFlags(subdir)...)
 	}
 
-	// Build exclude flags
-	excludeFlags := syncignore.BuildExcludeFlags(patterns)
 	excludeStr := ""
 	if len(excludeFlags) > 0 {
 		excludeStr = " " + strings.Join(excludeFlags, " ")
 	}
 
-	ftpCmd := fmt.Sprintf("mirror -R --dry-run --verbose%s '%s' '%s'", excludeStr, profile.Context, profile.RemotePath)
-	cmd := buildCommand(profile, ftpCmd)
+	return local, remote, excludeStr, nil
+}
 
-	cmd.Stdout = nil // Output goes directly to terminal
-	cmd.Stderr = nil
+// mirrorScope resolves the local and remote directories of a mirror and the
+// ignore rules that apply in the given direction
+func mirrorScope(profile *config.Profile, subdir string, dir syncignore.Direction) (string, string, *syncignore.Matcher, error) {
+	// Verify local path exists
+	absLocal, err := filepath.Abs(profile.Context)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("cannot resolve local path: %w", err)
+	}
 
-	return cmd.Run()
+	// Load .syncignore rules
+	ignore, err := syncignore.ForProfile(profile, dir)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to load .syncignore: %w", err)
+	}
+
+	local := absLocal
+	remote := profile.RemotePath
+	if subdir != "" {
+		if ignore.Matches(subdir, true) {
+			return "", "", nil, fmt.Errorf("directory ignored by .syncignore: %s", subdir)
+		}
+		local = filepath.Join(absLocal, subdir)
+		remote = path.Join(profile.RemotePath, filepath.ToSlash(subdir))
+	}
+
+	return local, remote, ignore, nil
 }
 
 // PushFile uploads a single file
 func PushFile(profile *config.Profile, filePath string) error {
+	if err := profile.CheckWritable(); err != nil {
+		return err
+	}
+
 	// Calculate relative path from local context
 	absFile, err := filepath.Abs(filePath)
 	if err != nil {
 		return fmt.Errorf("cannot resolve file path: %w", err)
 	}
 
-	absLocal, err := filepath.Abs(profile.Context)
+	relPath, err := checkFile(profile, absFile, syncignore.Up)
 	if err != nil {
-		return fmt.Errorf("cannot resolve local path: %w", err)
+		return err
 	}
 
-	// Check if file is within context
-	if !strings.HasPrefix(absFile, absLocal+"/") && absFile != absLocal {
-		return fmt.Errorf("file '%s' is not within context '%s'", absFile, absLocal)
+	remoteFile := filepath.Join(profile.RemotePath, relPath)
+	remoteDir := filepath.Dir(remoteFile)
+
+	if err := CheckProtected(profile, remoteFile); err != nil {
+		return err
 	}
 
-	// Calculate relative path and remote file location
-	relPath := strings.TrimPrefix(absFile, absLocal+"/")
+	ftpCmd := fmt.Sprintf("put -O '%s' '%s'", remoteDir, absFile)
+	cmd := buildCommand(profile, ftpCmd)
 
-	// Load .syncignore and check if file should be ignored
-	patterns, err := syncignore.Load(absLocal)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("upload failed: %s", parseError(string(output)))
+	}
+
+	return nil
+}
+
+// PullFile downloads a single file
+func PullFile(profile *config.Profile, filePath string) error {
+	// Build absolute file path
+	absFile, err := LocalFile(profile, filePath)
 	if err != nil {
-		return fmt.Errorf("failed to load .syncignore: %w", err)
+		return err
 	}
 
-	if syncignore.ShouldIgnore(relPath, patterns) {
-		return fmt.Errorf("file ignored by .syncignore: %s", relPath)
+	relPath, err := checkFile(profile, absFile, syncignore.Down)
+	if err != nil {
+		return err
 	}
 
 	remoteFile := filepath.Join(profile.RemotePath, relPath)
-	remoteDir := filepath.Dir(remoteFile)
 
-	ftpCmd := fmt.Sprintf("put -O '%s' '%s'", remoteDir, absFile)
+	ftpCmd := fmt.Sprintf("get '%s' -o '%s'", remoteFile, absFile)
 	cmd := buildCommand(profile, ftpCmd)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("upload failed: %s", parseError(string(output)))
+		return fmt.Errorf("download failed: %s", parseError(string(output)))
 	}
 
 	return nil
 }
 
-// PullFile downloads a single file
-func PullFile(profile *config.Profile, filePath string) error {
-	// Build absolute file path
-	var absFile string
-	if filepath.IsAbs(filePath) {
-		absFile = filePath
-	} else {
-		absLocal, err := filepath.Abs(profile.Context)
+// DeleteRemote deletes the remote counterpart of a local file, or of a local
+// directory if it is empty on the remote. A remote path that doesn't exist is
+// not an error.
+func DeleteRemote(profile *config.Profile, absPath string, isDir bool) error {
+	if err := profile.CheckWritable(); err != nil {
+		return err
+	}
+
+	relPath, err := splitContext(profile, absPath)
+	if err != nil {
+		return err
+	}
+	remotePath := filepath.Join(profile.RemotePath, relPath)
+	if err := CheckProtected(profile, remotePath); err != nil {
+		return err
+	}
+
+	// Directories are only removed once empty: they may hold ignored or
+	// protected files that exist only on the remote
+	ftpCmd := fmt.Sprintf("rm '%s'", remotePath)
+	if isDir {
+		ftpCmd = fmt.Sprintf("rmdir '%s'", remotePath)
+	}
+	output, err := buildCommand(profile, ftpCmd).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "No such file") {
+		return fmt.Errorf("delete failed: %s", parseError(string(output)))
+	}
+	return nil
+}
+
+// DeleteRemoteTree deletes the remote counterparts of local files, then of
+// local directories (deepest first; each must be empty on the remote by
+// then), in one session. Remote paths that don't exist are not an error.
+func DeleteRemoteTree(profile *config.Profile, absFiles, absDirs []string) error {
+	if err := profile.CheckWritable(); err != nil {
+		return err
+	}
+
+	remotes := make(map[string]string)
+	var commands []string
+	for i, absPath := range append(append([]string{}, absFiles...), absDirs...) {
+		relPath, err := splitContext(profile, absPath)
 		if err != nil {
-			return fmt.Errorf("cannot resolve local path: %w", err)
+			return err
+		}
+		remotePath := filepath.Join(profile.RemotePath, relPath)
+		if err := CheckProtected(profile, remotePath); err != nil {
+			return err
 		}
-		absFile = filepath.Join(absLocal, filePath)
+		remotes[remotePath] = absPath
+		if i < len(absFiles) {
+			commands = append(commands, fmt.Sprintf("rm '%s'", remotePath))
+		} else {
+			commands = append(commands, fmt.Sprintf("rmdir '%s'", remotePath))
+		}
+	}
+	if len(commands) == 0 {
+		return nil
 	}
 
+	output, err := buildCommand(profile, strings.Join(commands, "; ")).CombinedOutput()
+	if err != nil {
+		if failed := batchErrors(string(output), remotes); failed != "" {
+			return fmt.Errorf("delete failed: %s", parseError(failed))
+		}
+	}
+	return nil
+}
+
+// RenameRemote moves the remote counterpart of a local file or directory to
+// the counterpart of its new local path. Returns ErrRemoteNotFound if the old
+// path doesn't exist on the remote.
+func RenameRemote(profile *config.Profile, oldPath, newPath string) error {
+	if err := profile.CheckWritable(); err != nil {
+		return err
+	}
+
+	oldRel, err := splitContext(profile, oldPath)
+	if err != nil {
+		return err
+	}
+	newRel, err := splitContext(profile, newPath)
+	if err != nil {
+		return err
+	}
+	oldRemote := filepath.Join(profile.RemotePath, oldRel)
+	newRemote := filepath.Join(profile.RemotePath, newRel)
+	for _, remote := range []string{oldRemote, newRemote} {
+		if err := CheckProtected(profile, remote); err != nil {
+			return err
+		}
+	}
+
+	ftpCmd := fmt.Sprintf("mkdir -p -f '%s'; mv '%s' '%s'", filepath.Dir(newRemote), oldRemote, newRemote)
+	output, err := buildCommand(profile, ftpCmd).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "No such file") {
+			return fmt.Errorf("%w: %s", ErrRemoteNotFound, oldRemote)
+		}
+		return fmt.Errorf("rename failed: %s", parseError(string(output)))
+	}
+	return nil
+}
+
+// LocalFile resolves the local path of a file for single-file transfers.
+// Relative paths are taken relative to the profile's context.
+func LocalFile(profile *config.Profile, filePath string) (string, error) {
+	if filepath.IsAbs(filePath) {
+		return filePath, nil
+	}
 	absLocal, err := filepath.Abs(profile.Context)
 	if err != nil {
-		return fmt.Errorf("cannot resolve local path: %w", err)
+		return "", fmt.Errorf("cannot resolve local path: %w", err)
 	}
+	return filepath.Join(absLocal, filePath), nil
+}
 
-	// Check if file is within context
-	if !strings.HasPrefix(absFile, absLocal+"/") && absFile != absLocal {
-		return fmt.Errorf("file '%s' is not within context '%s'", absFile, absLocal)
+// RemoteFile returns the remote path corresponding to an absolute local file
+func RemoteFile(profile *config.Profile, absFile string) (string, error) {
+	relPath, err := splitContext(profile, absFile)
+	if err != nil {
+		return "", err
 	}
+	return filepath.Join(profile.RemotePath, relPath), nil
+}
 
-	// Calculate relative path and remote file location
-	relPath := strings.TrimPrefix(absFile, absLocal+"/")
+// checkFile verifies a file may be transferred on its own in the given
+// direction: it must be within the context and not ignored.
+// Returns its path relative to the context.
+func checkFile(profile *config.Profile, absFile string, dir syncignore.Direction) (string, error) {
+	relPath, err := splitContext(profile, absFile)
+	if err != nil {
+		return "", err
+	}
 
 	// Load .syncignore and check if file should be ignored
-	patterns, err := syncignore.Load(absLocal)
+	ignore, err := syncignore.ForProfile(profile, dir)
 	if err != nil {
-		return fmt.Errorf("failed to load .syncignore: %w", err)
+		return "", fmt.Errorf("failed to load .syncignore: %w", err)
 	}
 
-	if syncignore.ShouldIgnore(relPath, patterns) {
-		return fmt.Errorf("file ignored by .syncignore: %s", relPath)
+	if ignore.Matches(relPath, false) {
+		return "", fmt.Errorf("file ignored by .syncignore: %s", relPath)
 	}
 
-	remoteFile := filepath.Join(profile.RemotePath, relPath)
+	return relPath, nil
+}
 
-	ftpCmd := fmt.Sprintf("get '%s' -o '%s'", remoteFile, absFile)
-	cmd := buildCommand(profile, ftpCmd)
+// CheckProtected returns ErrProtected if remoteFile (an absolute remote path)
+// matches the protect list of the mapping that contains it
+func CheckProtected(profile *config.Profile, remoteFile string) error {
+	m, ok := profile.MappingForRemote(remoteFile)
+	if !ok {
+		return nil
+	}
+
+	protect, err := syncignore.ProtectForProfile(profile.ForMapping(m))
+	if err != nil {
+		return fmt.Errorf("failed to load protect list: %w", err)
+	}
+
+	rel := strings.TrimPrefix(remoteFile, strings.TrimSuffix(path.Clean(m.Remote), "/")+"/")
+	if protect.Matches(rel, false) {
+		return fmt.Errorf("%w: %s", ErrProtected, remoteFile)
+	}
+	return nil
+}
+
+// splitContext returns the file's path relative to the profile's context.
+// Fails if the file is not within the context.
+func splitContext(profile *config.Profile, absFile string) (string, error) {
+	absLocal, err := filepath.Abs(profile.Context)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve local path: %w", err)
+	}
+
+	// Check if file is within context
+	if !strings.HasPrefix(absFile, absLocal+"/") && absFile != absLocal {
+		return "", fmt.Errorf("file '%s' is not within context '%s'", absFile, absLocal)
+	}
+
+	return strings.TrimPrefix(absFile, absLocal+"/"), nil
+}
+
+// DownloadFiles downloads remote files to local paths (remote path -> local path).
+// Local parent directories are created as needed. Files that don't exist on
+// the remote are skipped; callers can check which local files were written.
+func DownloadFiles(profile *config.Profile, files map[string]string) error {
+	if len(files) == 0 {
+		return nil
+	}
 
+	var commands []string
+	for remote, local := range files {
+		if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+			return fmt.Errorf("cannot create directory: %w", err)
+		}
+		commands = append(commands, fmt.Sprintf("get '%s' -o '%s'", remote, local))
+	}
+
+	// lftp keeps going after a failed command, so missing files don't stop
+	// the batch; any other failure does
+	cmd := buildCommand(profile, strings.Join(commands, "; "))
 	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if failed := batchErrors(string(output), files); failed != "" {
+			return fmt.Errorf("download failed: %s", parseError(failed))
+		}
+	}
+
+	return nil
+}
+
+// batchErrors returns the error output of a failed batch of transfers or
+// deletes, leaving out the errors for requested remote paths (the keys of
+// files) that don't exist. Returns "" if missing paths were the only errors.
+func batchErrors(output string, files map[string]string) string {
+	var failed []string
+	missing := 0
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "No such file") && namesRemote(line, files) {
+			missing++
+			continue
+		}
+		failed = append(failed, line)
+	}
+	if len(failed) == 0 && missing == 0 {
+		return "Unknown error"
+	}
+	return strings.Join(failed, "\n")
+}
+
+// namesRemote reports whether an lftp error line is about one of the remote files
+func namesRemote(line string, files map[string]string) bool {
+	for remote := range files {
+		if strings.Contains(line, remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadDir mirrors a remote directory into a local directory
+func DownloadDir(profile *config.Profile, remoteDir, localDir string) error {
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return fmt.Errorf("cannot create directory: %w", err)
+	}
+
+	ftpCmd := fmt.Sprintf("mirror '%s' '%s'", remoteDir, localDir)
+	output, err := buildCommand(profile, ftpCmd).CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("download failed: %s", parseError(string(output)))
 	}
@@ -239,43 +525,63 @@ func PullFile(profile *config.Profile, filePath string) error {
 	return nil
 }
 
+// UploadFiles uploads local files to remote paths (local path -> remote path),
+// creating remote parent directories as needed
+func UploadFiles(profile *config.Profile, files map[string]string) error {
+	if err := profile.CheckWritable(); err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	var commands []string
+	for local, remote := range files {
+		if err := CheckProtected(profile, remote); err != nil {
+			return err
+		}
+		commands = append(commands,
+			fmt.Sprintf("mkdir -p -f '%s'", filepath.Dir(remote)),
+			fmt.Sprintf("put '%s' -o '%s'", local, remote))
+	}
+
+	cmd := buildCommand(profile, strings.Join(commands, "; "))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("upload failed: %s", parseError(string(output)))
+	}
+
+	return nil
+}
+
 // parseResult parses lftp output and determines success/failure
 func parseResult(output []byte, err error) (*Result, error) {
 	result := &Result{
 		Output: string(output),
 	}
 
-	// Check for .ftpquota errors
-	hasFtpQuota := strings.Contains(result.Output, ".ftpquota")
-	result.HasFtpQuota = hasFtpQuota
-
 	// Count transferred/removed files
 	transferPattern := regexp.MustCompile(`(?i)(Transferring|Removing)`)
 	matches := transferPattern.FindAllString(result.Output, -1)
 	result.FileCount = len(matches)
 
-	// Check for errors (excluding .ftpquota)
-	errorPattern := regexp.MustCompile(`(?i)(error|failed|prohibited)`)
-	errorLines := errorPattern.FindAllString(result.Output, -1)
-	nonFtpQuotaErrors := 0
-	for _, line := range errorLines {
-		if !strings.Contains(line, ".ftpquota") {
-			nonFtpQuotaErrors++
+	// Collect changed file names and transferred bytes
+	for _, m := range changedFilePattern.FindAllStringSubmatch(result.Output, -1) {
+		result.Files = append(result.Files, m[1])
+	}
+	for _, m := range bytesPattern.FindAllStringSubmatch(result.Output, -1) {
+		if n, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			result.Bytes += n
 		}
 	}
 
 	// Determine success
-	if err != nil && hasFtpQuota && nonFtpQuotaErrors == 0 {
-		// Only .ftpquota errors - treat as warning
-		result.Success = true
-		result.ErrorMessage = "Warning: .ftpquota is server-protected"
-	} else if err != nil {
-		// Real errors
+	if err != nil {
 		result.Success = false
 		result.Error = err
 		result.ErrorMessage = parseError(result.Output)
 	} else {
-		// Success
 		result.Success = true
 	}
 
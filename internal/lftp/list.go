@@ -0,0 +1,90 @@
+package lftp
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/syncignore"
+)
+
+// ListLocal returns the files a mirror of subdir in the given direction would
+// consider on the local side, relative to the mirror root. Ignored files are
+// left out; a missing directory has no files.
+func ListLocal(profile *config.Profile, subdir string, dir syncignore.Direction) ([]string, error) {
+	local, _, ignore, err := mirrorScope(profile, subdir, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if p == local {
+			return nil
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if ignore.Matches(filepath.Join(subdir, rel), true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !ignore.Matches(filepath.Join(subdir, rel), false) {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list local files: %w", err)
+	}
+
+	return files, nil
+}
+
+// ListRemote returns the files a mirror of subdir in the given direction
+// would consider on the remote side, relative to the mirror root. Ignored
+// files are left out; a missing directory has no files.
+func ListRemote(profile *config.Profile, subdir string, dir syncignore.Direction) ([]string, error) {
+	_, remote, ignore, err := mirrorScope(profile, subdir, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := buildCommand(profile, fmt.Sprintf("find '%s'", remote)).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "No such file") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot list remote files: %s", parseError(string(output)))
+	}
+
+	prefix := strings.TrimSuffix(remote, "/") + "/"
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		// Directories are listed with a trailing slash
+		if line == "" || strings.HasSuffix(line, "/") {
+			continue
+		}
+		rel := strings.TrimPrefix(line, prefix)
+		if !ignore.Matches(path.Join(filepath.ToSlash(subdir), rel), false) {
+			files = append(files, rel)
+		}
+	}
+
+	return files, nil
+}
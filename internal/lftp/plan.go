@@ -0,0 +1,303 @@
+package lftp
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/syncignore"
+)
+
+// Operation actions
+const (
+	ActionUpload   = "upload"
+	ActionDownload = "download"
+	ActionDelete   = "delete"
+	ActionMkdir    = "mkdir"
+	ActionChmod    = "chmod"
+	ActionCopy     = "copy"
+	ActionSymlink  = "symlink"
+)
+
+// Operation is a single change a sync makes (or would make) on the destination side
+type Operation struct {
+	Action string // One of the Action* constants
+	Path   string // Path relative to the destination root
+	IsDir  bool   // Operation applies to a directory
+	Mode   string // New permissions (chmod only)
+	Target string // Link target (symlink) or source (copy)
+}
+
+// Format renders an operation as one line of structured output.
+// Real runs and dry runs print the same format so scripts can preview a
+// sync and then execute it. root is the destination root the path is
+// relative to.
+func (op Operation) Format(root string) string {
+	p := path.Join(root, op.Path)
+	if op.IsDir && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+
+	switch op.Action {
+	case ActionChmod:
+		return fmt.Sprintf("%-8s %s %s", op.Action, op.Mode, p)
+	case ActionSymlink:
+		return fmt.Sprintf("%-8s %s -> %s", op.Action, p, op.Target)
+	case ActionCopy:
+		if op.Target != "" {
+			return fmt.Sprintf("%-8s %s (from %s)", op.Action, p, path.Join(root, op.Target))
+		}
+		return fmt.Sprintf("%-8s %s", op.Action, p)
+	default:
+		return fmt.Sprintf("%-8s %s", op.Action, p)
+	}
+}
+
+// PlanPush returns the operation `push` would perform for a file, without
+// changing anything. Fails if the file would be refused (outside the
+// context, ignored or protected on the remote).
+func PlanPush(profile *config.Profile, absFile string) ([]Operation, error) {
+	relPath, err := checkFile(profile, absFile, syncignore.Up)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckProtected(profile, path.Join(profile.RemotePath, relPath)); err != nil {
+		return nil, err
+	}
+	return []Operation{{Action: ActionUpload, Path: relPath}}, nil
+}
+
+// PlanPull returns the operation `pull` would perform for a file, without
+// changing anything
+func PlanPull(profile *config.Profile, absFile string) ([]Operation, error) {
+	relPath, err := checkFile(profile, absFile, syncignore.Down)
+	if err != nil {
+		return nil, err
+	}
+	return []Operation{{Action: ActionDownload, Path: relPath}}, nil
+}
+
+// PlanUp returns the operations `up` would perform, without changing anything
+func PlanUp(profile *config.Profile, subdir string) ([]Operation, error) {
+	local, remote, excludeStr, err := mirrorRoots(profile, subdir, syncignore.Up)
+	if err != nil {
+		return nil, err
+	}
+
+	ftpCmd := fmt.Sprintf("mirror -R --dry-run --delete%s '%s' '%s'", excludeStr, local, remote)
+	output, err := buildCommand(profile, ftpCmd).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("dry-run failed: %s", parseError(string(output)))
+	}
+
+	return parsePlan(string(output), remote), nil
+}
+
+// PlanDown returns the operations `down` would perform, without changing anything
+func PlanDown(profile *config.Profile, subdir string) ([]Operation, error) {
+	local, remote, excludeStr, err := mirrorRoots(profile, subdir, syncignore.Down)
+	if err != nil {
+		return nil, err
+	}
+
+	ftpCmd := fmt.Sprintf("mirror --dry-run --delete%s '%s' '%s'", excludeStr, remote, local)
+	output, err := buildCommand(profile, ftpCmd).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("dry-run failed: %s", parseError(string(output)))
+	}
+
+	return parsePlan(string(output), local), nil
+}
+
+// PlanDownSince returns the downloads of remote files modified after since
+// that are newer than their local copy (or missing locally), without
+// changing anything
+func PlanDownSince(profile *config.Profile, subdir string, since time.Time) ([]Operation, error) {
+	local, remote, excludeStr, err := mirrorRoots(profile, subdir, syncignore.Down)
+	if err != nil {
+		return nil, err
+	}
+
+	ftpCmd := fmt.Sprintf("mirror --dry-run --only-newer --newer-than=@%d%s '%s' '%s'", since.Unix(), excludeStr, remote, local)
+	output, err := buildCommand(profile, ftpCmd).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("dry-run failed: %s", parseError(string(output)))
+	}
+
+	var downloads []Operation
+	for _, op := range parsePlan(string(output), local) {
+		if op.Action == ActionDownload {
+			downloads = append(downloads, op)
+		}
+	}
+	return downloads, nil
+}
+
+// parsePlan parses the command script printed by `mirror --dry-run`.
+// Lines look like:
+//
+//	put -O sftp://host/var/www/sub /home/user/site/sub/index.html
+//	get -O /home/user/site/sub sftp://host/var/www/sub/index.html
+//	rm sftp://host/var/www/old.html
+//	rm -r sftp://host/var/www/olddir
+//	mkdir sftp://host/var/www/newdir
+//	chmod 644 sftp://host/var/www/sub/index.html
+//
+// destRoot is the destination directory of the mirror; operation paths are
+// returned relative to it.
+func parsePlan(output, destRoot string) []Operation {
+	var ops []Operation
+
+	for _, line := range strings.Split(output, "\n") {
+		args := splitScriptLine(line)
+		if len(args) < 2 {
+			continue
+		}
+
+		var op Operation
+		switch args[0] {
+		case "get", "put":
+			op.Action = ActionDownload
+			if args[0] == "put" {
+				op.Action = ActionUpload
+			}
+			dir := ""
+			for i := 1; i < len(args)-1; i++ {
+				if args[i] == "-O" {
+					dir = scriptPath(args[i+1])
+				}
+			}
+			op.Path = path.Join(dir, path.Base(scriptPath(args[len(args)-1])))
+		case "rm", "rmdir":
+			op.Action = ActionDelete
+			op.IsDir = args[0] == "rmdir" || args[1] == "-r" || args[1] == "-rf"
+			op.Path = scriptPath(args[len(args)-1])
+		case "mkdir":
+			op.Action = ActionMkdir
+			op.IsDir = true
+			op.Path = scriptPath(args[len(args)-1])
+		case "chmod":
+			op.Action = ActionChmod
+			op.Mode = args[1]
+			op.Path = scriptPath(args[len(args)-1])
+		default:
+			continue
+		}
+
+		rel, ok := relativeTo(op.Path, destRoot)
+		if !ok {
+			continue
+		}
+		op.Path = rel
+		ops = append(ops, op)
+	}
+
+	return ops
+}
+
+// parseLog parses the verbose log of a real mirror run into operations.
+// Lines look like "Transferring file `sub/index.html'", "Removing old file `old.html'"
+// and "Making directory `newdir'"; paths are relative to the mirror root.
+// transferAction is ActionUpload or ActionDownload depending on the mirror direction.
+func parseLog(output, transferAction string) []Operation {
+	var ops []Operation
+	for _, m := range logPattern.FindAllStringSubmatch(output, -1) {
+		op := Operation{Path: m[2]}
+		switch m[1] {
+		case "Transferring file":
+			op.Action = transferAction
+		case "Removing old file":
+			op.Action = ActionDelete
+		case "Removing old directory":
+			op.Action = ActionDelete
+			op.IsDir = true
+		case "Making directory":
+			op.Action = ActionMkdir
+			op.IsDir = true
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// scriptPath converts a path or URL printed by lftp into a plain path
+func scriptPath(arg string) string {
+	if strings.HasPrefix(arg, "file:") {
+		arg = strings.TrimPrefix(arg, "file:")
+		if unescaped, err := url.PathUnescape(arg); err == nil {
+			arg = unescaped
+		}
+		return arg
+	}
+	if strings.Contains(arg, "://") {
+		if u, err := url.Parse(arg); err == nil {
+			return u.Path
+		}
+	}
+	return arg
+}
+
+// relativeTo returns p relative to root, or false if p is outside root
+func relativeTo(p, root string) (string, bool) {
+	p = path.Clean(p)
+	root = path.Clean(root)
+	if p == root {
+		return ".", true
+	}
+	if root == "/" {
+		return strings.TrimPrefix(p, "/"), strings.HasPrefix(p, "/")
+	}
+	if strings.HasPrefix(p, root+"/") {
+		return strings.TrimPrefix(p, root+"/"), true
+	}
+	return "", false
+}
+
+// splitScriptLine splits an lftp script line into arguments,
+// honoring single quotes, double quotes and backslash escapes
+func splitScriptLine(line string) []string {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(strings.TrimSpace(line))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
@@ -0,0 +1,88 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"sftp-sync/internal/state"
+)
+
+const (
+	lockDir = "locks"
+)
+
+// BusyError means another process holds the lock of a profile
+type BusyError struct {
+	PID       int
+	Operation string
+}
+
+func (e *BusyError) Error() string {
+	if e.PID == 0 {
+		return "profile busy"
+	}
+	return fmt.Sprintf("profile busy (pid %d, operation %s)", e.PID, e.Operation)
+}
+
+// Lock is a held advisory lock on a profile. It guards remote changes of
+// sftp-sync processes against each other; it doesn't stop other tools.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock of a profile for an operation (up, down, daemon).
+// If another process holds it, Acquire fails with a *BusyError, or with wait
+// set, blocks until it is released. The lock is also released when the
+// process exits.
+func Acquire(profileName, operation string, wait bool) (*Lock, error) {
+	p, err := state.Path(lockDir, profileName+".lock")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open lock file: %w", err)
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		busy := holder(f)
+		if !wait {
+			f.Close()
+			return nil, busy
+		}
+		fmt.Fprintf(os.Stderr, "Waiting for %s: %v\n", profileName, busy)
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot lock profile: %w", err)
+	}
+
+	// Tell processes that find the profile busy who holds it
+	f.Truncate(0)
+	f.WriteAt([]byte(fmt.Sprintf("%d %s\n", os.Getpid(), operation)), 0)
+	return &Lock{file: f}, nil
+}
+
+// Release releases the lock
+func (l *Lock) Release() {
+	l.file.Truncate(0)
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+}
+
+// holder reads who holds a lock from its file ("pid operation")
+func holder(f *os.File) *BusyError {
+	data := make([]byte, 256)
+	n, _ := f.ReadAt(data, 0)
+	pid, op, _ := strings.Cut(strings.TrimSpace(string(data[:n])), " ")
+	busy := &BusyError{Operation: op}
+	busy.PID, _ = strconv.Atoi(pid)
+	return busy
+}
@@ -31,6 +31,11 @@ func mountRclone(profile *config.Profile, mountPoint string) error {
 		"--no-modtime",
 	}
 
+	// Read-only profiles never write to the server
+	if profile.ReadOnly {
+		args = append(args, "--read-only")
+	}
+
 	cmd := exec.Command("rclone", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
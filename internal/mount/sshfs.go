@@ -29,6 +29,11 @@ func mountSSHFS(profile *config.Profile, mountPoint string) error {
 		"-o", "ServerAliveCountMax=3",
 	}
 
+	// Read-only profiles never write to the server
+	if profile.ReadOnly {
+		args = append(args, "-o", "ro")
+	}
+
 	// Add authentication-specific options
 	if useSSHKey {
 		// Use SSH key authentication
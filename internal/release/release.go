@@ -0,0 +1,358 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/deps"
+	"sftp-sync/internal/lftp"
+)
+
+const (
+	// ReleasesDir is the directory under remotePath that holds release directories
+	ReleasesDir = "releases"
+	// CurrentLink is the symlink under remotePath that points at the live release
+	CurrentLink = "current"
+	// timestampFormat names release directories so they sort chronologically
+	timestampFormat = "20060102150405"
+)
+
+var (
+	ErrUnsupportedProtocol = errors.New("release deploys require an sftp profile with shell access")
+	ErrNoReleases          = errors.New("no releases found")
+	ErrNoPreviousRelease   = errors.New("no previous release to roll back to")
+	ErrReleaseNotFound     = errors.New("release not found")
+)
+
+// Deployment describes the outcome of a release deploy
+type Deployment struct {
+	Release  string       // Name of the new release directory
+	Previous string       // Release that was live before the deploy ("" if none)
+	Result   *lftp.Result // Result of the upload into the release directory
+	Pruned   []string     // Old releases that were removed
+}
+
+// releasesPath returns the remote releases directory for a profile
+func releasesPath(profile *config.Profile) string {
+	return path.Join(profile.RemotePath, ReleasesDir)
+}
+
+// currentPath returns the remote path of the current symlink
+func currentPath(profile *config.Profile) string {
+	return path.Join(profile.RemotePath, CurrentLink)
+}
+
+// List returns all release names (oldest first) and the release the current
+// symlink points to. It doesn't change the remote: without a releases
+// directory (created by the first Deploy) there are no releases.
+func List(profile *config.Profile) ([]string, string, error) {
+	if profile.Protocol != "sftp" {
+		return nil, "", ErrUnsupportedProtocol
+	}
+
+	output, err := runSSH(profile, fmt.Sprintf("if [ -d %s ]; then ls -1 %s; fi",
+		shellQuote(releasesPath(profile)), shellQuote(releasesPath(profile))))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var releases []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			releases = append(releases, line)
+		}
+	}
+	sort.Strings(releases)
+
+	// readlink fails when there is no current symlink yet - that's not an error
+	target, err := runSSH(profile, fmt.Sprintf("readlink %s || true", shellQuote(currentPath(profile))))
+	if err != nil {
+		return nil, "", err
+	}
+	current := path.Base(strings.TrimSpace(target))
+	if strings.TrimSpace(target) == "" {
+		current = ""
+	}
+
+	return releases, current, nil
+}
+
+// Deploy uploads the profile's context into a new release directory and
+// atomically switches the current symlink to it. The live tree is never
+// touched if the upload fails.
+func Deploy(profile *config.Profile) (*Deployment, error) {
+	if err := profile.CheckWritable(); err != nil {
+		return nil, err
+	}
+
+	if err := deps.CheckRequired("ssh"); err != nil {
+		return nil, err
+	}
+
+	releases, current, err := List(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	name := newName()
+	for contains(releases, name) {
+		// Two deploys in the same second - wait for a fresh timestamp
+		time.Sleep(time.Second)
+		name = newName()
+	}
+	releaseDir := path.Join(releasesPath(profile), name)
+
+	// Seed the new release from the live one so only changes are uploaded
+	var prepare string
+	if profile.ReleaseCopyPrevious && current != "" {
+		prepare = fmt.Sprintf("cp -a %s %s",
+			shellQuote(path.Join(releasesPath(profile), current)), shellQuote(releaseDir))
+	} else {
+		// Also creates the releases directory on the first deploy
+		prepare = fmt.Sprintf("mkdir -p %s", shellQuote(releaseDir))
+	}
+	if _, err := runSSH(profile, prepare); err != nil {
+		return nil, fmt.Errorf("failed to create release directory: %w", err)
+	}
+
+	// Upload into the release directory instead of the live tree
+	target := *profile
+	target.RemotePath = releaseDir
+
+	deployment := &Deployment{
+		Release:  name,
+		Previous: current,
+	}
+
+	result, err := lftp.SyncUp(&target, "")
+	if err == nil && !result.Success {
+		err = fmt.Errorf("upload failed: %s", result.ErrorMessage)
+	}
+	deployment.Result = result
+	if err != nil {
+		// Remove the half-uploaded release; the current symlink still points at the old one
+		if _, rmErr := runSSH(profile, fmt.Sprintf("rm -rf %s", shellQuote(releaseDir))); rmErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to remove incomplete release %s: %v\n", name, rmErr)
+		}
+		return deployment, err
+	}
+
+	if err := switchCurrent(profile, name); err != nil {
+		return deployment, err
+	}
+
+	pruned, err := prune(profile, append(releases, name), name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to prune old releases: %v\n", err)
+	}
+	deployment.Pruned = pruned
+
+	return deployment, nil
+}
+
+// Plan returns the operations Deploy would perform, without changing anything.
+// Paths are relative to the profile's remote path.
+func Plan(profile *config.Profile) ([]lftp.Operation, error) {
+	if err := deps.CheckRequired("ssh"); err != nil {
+		return nil, err
+	}
+
+	releases, current, err := List(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	name := newName()
+	releaseRel := path.Join(ReleasesDir, name)
+
+	// Compare against the release the new one would be seeded from
+	target := *profile
+	var ops []lftp.Operation
+	if profile.ReleaseCopyPrevious && current != "" {
+		ops = append(ops, lftp.Operation{Action: lftp.ActionCopy, Path: releaseRel, IsDir: true, Target: path.Join(ReleasesDir, current)})
+		target.RemotePath = path.Join(releasesPath(profile), current)
+	} else {
+		ops = append(ops, lftp.Operation{Action: lftp.ActionMkdir, Path: releaseRel, IsDir: true})
+		target.RemotePath = path.Join(releasesPath(profile), name)
+	}
+
+	planned, err := lftp.PlanUp(&target, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range planned {
+		op.Path = path.Join(releaseRel, op.Path)
+		ops = append(ops, op)
+	}
+
+	ops = append(ops, lftp.Operation{Action: lftp.ActionSymlink, Path: CurrentLink, Target: releaseRel})
+	for _, old := range pruneCandidates(profile, append(releases, name), name) {
+		ops = append(ops, lftp.Operation{Action: lftp.ActionDelete, Path: path.Join(ReleasesDir, old), IsDir: true})
+	}
+
+	return ops, nil
+}
+
+// RollbackTarget returns the live release and the release Rollback would
+// switch to, without changing anything.
+// If target is empty, the release before the current one is used.
+func RollbackTarget(profile *config.Profile, target string) (string, string, error) {
+	if err := deps.CheckRequired("ssh"); err != nil {
+		return "", "", err
+	}
+
+	releases, current, err := List(profile)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list releases: %w", err)
+	}
+	if len(releases) == 0 {
+		return "", "", ErrNoReleases
+	}
+
+	if target == "" {
+		idx := indexOf(releases, current)
+		if idx <= 0 {
+			return current, "", ErrNoPreviousRelease
+		}
+		target = releases[idx-1]
+	} else if !contains(releases, target) {
+		return current, "", fmt.Errorf("%w: %s", ErrReleaseNotFound, target)
+	}
+
+	return current, target, nil
+}
+
+// Rollback repoints the current symlink to an earlier release.
+// If target is empty, the release before the current one is used.
+// Returns the release that was live before and the release that is live now.
+func Rollback(profile *config.Profile, target string) (string, string, error) {
+	if err := profile.CheckWritable(); err != nil {
+		return "", "", err
+	}
+
+	current, target, err := RollbackTarget(profile, target)
+	if err != nil {
+		return current, "", err
+	}
+
+	if err := switchCurrent(profile, target); err != nil {
+		return current, "", err
+	}
+
+	return current, target, nil
+}
+
+// newName returns the release name for a deploy starting now
+func newName() string {
+	return time.Now().UTC().Format(timestampFormat)
+}
+
+// switchCurrent atomically repoints the current symlink using rename(2)
+func switchCurrent(profile *config.Profile, name string) error {
+	current := currentPath(profile)
+	tmpLink := path.Join(profile.RemotePath, "."+CurrentLink+".tmp")
+	linkTarget := path.Join(ReleasesDir, name)
+
+	script := fmt.Sprintf(
+		"if [ -e %[1]s ] && [ ! -L %[1]s ]; then echo '%[1]s exists and is not a symlink' >&2; exit 1; fi && "+
+			"ln -sfn %[2]s %[3]s && mv -Tf %[3]s %[1]s",
+		shellQuote(current), shellQuote(linkTarget), shellQuote(tmpLink))
+
+	if _, err := runSSH(profile, script); err != nil {
+		return fmt.Errorf("failed to switch current release: %w", err)
+	}
+	return nil
+}
+
+// prune removes the oldest releases beyond the profile's keep limit.
+// The live release is never removed.
+func prune(profile *config.Profile, releases []string, live string) ([]string, error) {
+	var pruned []string
+	for _, name := range pruneCandidates(profile, releases, live) {
+		dir := path.Join(releasesPath(profile), name)
+		if _, err := runSSH(profile, fmt.Sprintf("rm -rf %s", shellQuote(dir))); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, name)
+	}
+
+	return pruned, nil
+}
+
+// pruneCandidates returns the releases prune would remove
+func pruneCandidates(profile *config.Profile, releases []string, live string) []string {
+	sort.Strings(releases)
+	if len(releases) <= profile.ReleaseKeep {
+		return nil
+	}
+
+	var candidates []string
+	for _, name := range releases[:len(releases)-profile.ReleaseKeep] {
+		if name != live {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// runSSH runs a shell command on the remote host and returns its output
+func runSSH(profile *config.Profile, command string) (string, error) {
+	args := []string{
+		"-p", fmt.Sprintf("%d", profile.Port),
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "ConnectTimeout=10",
+	}
+
+	var cmd *exec.Cmd
+	if profile.SSHKey != "" {
+		args = append(args, "-o", "BatchMode=yes", "-i", profile.SSHKey,
+			fmt.Sprintf("%s@%s", profile.Username, profile.Host), command)
+		cmd = exec.Command("ssh", args...)
+	} else {
+		// Password authentication needs sshpass to feed the password non-interactively
+		if !deps.Check("sshpass") {
+			return "", fmt.Errorf("password authentication for release deploys requires sshpass (or set sshKey)")
+		}
+		args = append([]string{"-e", "ssh"}, args...)
+		args = append(args, fmt.Sprintf("%s@%s", profile.Username, profile.Host), command)
+		cmd = exec.Command("sshpass", args...)
+		cmd.Env = append(os.Environ(), "SSHPASS="+profile.Password)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("remote command failed: %s", msg)
+	}
+
+	return string(output), nil
+}
+
+// shellQuote quotes a string for safe use in a POSIX shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func contains(list []string, s string) bool {
+	return indexOf(list, s) >= 0
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
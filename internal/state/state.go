@@ -0,0 +1,45 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	DefaultStateDir = ".local/state/sftp-sync"
+)
+
+// Dir returns the directory where sftp-sync keeps local state (backups, history, locks).
+// Uses $XDG_STATE_HOME/sftp-sync if set, otherwise ~/.local/state/sftp-sync.
+// The directory is created if it doesn't exist.
+func Dir() (string, error) {
+	var dir string
+	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+		dir = filepath.Join(xdg, "sftp-sync")
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine home directory: %w", err)
+		}
+		dir = filepath.Join(home, DefaultStateDir)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("cannot create state directory: %w", err)
+	}
+	return dir, nil
+}
+
+// Path returns a path inside the state directory, creating parent directories as needed
+func Path(elem ...string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(append([]string{dir}, elem...)...)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", fmt.Errorf("cannot create state directory: %w", err)
+	}
+	return p, nil
+}
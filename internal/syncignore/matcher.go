@@ -0,0 +1,503 @@
+package syncignore
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Rule is one compiled pattern, with gitignore semantics
+type Rule struct {
+	Pattern string // Pattern as written
+	Source  string // File the rule was read from, or a description such as "config"
+	Line    int    // Line in Source (0 if not from a file)
+	Negate  bool   // "!pattern": re-include paths an earlier rule matched
+	DirOnly bool   // "pattern/": only matches directories
+
+	segments []string // Path segments from the context root; "**" matches any number of directories
+	re       *regexp.Regexp
+}
+
+// newRule compiles a gitignore-style pattern. base is the directory the
+// pattern is relative to ("" for the context root, slash-separated).
+// Returns nil for blank lines and comments.
+func newRule(pattern, base, source string, line int) *Rule {
+	p := trimTrailingSpace(pattern)
+	if p == "" || strings.HasPrefix(p, "#") {
+		return nil
+	}
+
+	rule := &Rule{Pattern: pattern, Source: source, Line: line}
+	if strings.HasPrefix(p, "!") {
+		rule.Negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\!`) || strings.HasPrefix(p, `\#`) {
+		p = p[1:]
+	}
+
+	if strings.HasSuffix(p, "/") {
+		rule.DirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return nil
+	}
+
+	// A slash at the start or in the middle anchors the pattern to its base
+	// directory; otherwise it matches at any depth below it
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	if base != "" {
+		rule.segments = strings.Split(base, "/")
+	}
+	if !anchored {
+		rule.segments = append(rule.segments, "**")
+	}
+	rule.segments = append(rule.segments, strings.Split(p, "/")...)
+	rule.re = regexp.MustCompile("^" + segmentsRegex(rule.segments) + "$")
+
+	return rule
+}
+
+// rebased returns copies of the rule for paths relative to sub, a directory
+// below the one the rule was written for
+func (r *Rule) rebased(sub []string) []*Rule {
+	var rules []*Rule
+	for _, segs := range rebase(r.segments, sub) {
+		if len(segs) == 0 {
+			continue // Matches sub itself, not anything inside it
+		}
+		rule := *r
+		rule.segments = segs
+		rule.re = regexp.MustCompile("^" + segmentsRegex(segs) + "$")
+		rules = append(rules, &rule)
+	}
+	return rules
+}
+
+// trimTrailingSpace removes trailing spaces unless they are escaped with a backslash
+func trimTrailingSpace(p string) string {
+	p = strings.TrimRight(p, "\r")
+	for strings.HasSuffix(p, " ") && !strings.HasSuffix(p, `\ `) {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// matches reports whether the rule matches a path relative to the context root
+func (r *Rule) matches(relPath string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	return r.re.MatchString(relPath)
+}
+
+// String describes where the rule came from, e.g. ".syncignore:3:*.log"
+func (r *Rule) String() string {
+	if r.Line > 0 {
+		return fmt.Sprintf("%s:%d:%s", r.Source, r.Line, r.Pattern)
+	}
+	return fmt.Sprintf("%s:%s", r.Source, r.Pattern)
+}
+
+// segmentsRegex converts pattern segments to a regular expression body.
+// "**" as a whole segment matches zero or more directories (or, at the end,
+// everything inside); any other "*" stays within a segment.
+func segmentsRegex(segments []string) string {
+	var b strings.Builder
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		if seg == "**" {
+			if last {
+				b.WriteString(".+")
+			} else {
+				b.WriteString("(.*/)?")
+			}
+			continue
+		}
+		b.WriteString(globRegex(seg))
+		if !last {
+			b.WriteString("/")
+		}
+	}
+	return b.String()
+}
+
+// globRegex converts a single path segment glob to a regular expression
+func globRegex(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			b.WriteString("[^/]*")
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			} else {
+				b.WriteString(`\\`)
+			}
+		case '[':
+			end := classEnd(glob, i)
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// classEnd returns the index of the "]" closing the character class that
+// starts at glob[start], or -1 if it isn't closed
+func classEnd(glob string, start int) int {
+	i := start + 1
+	if i < len(glob) && (glob[i] == '!' || glob[i] == '^') {
+		i++
+	}
+	if i < len(glob) && glob[i] == ']' {
+		i++ // "]" right after the opening bracket is literal
+	}
+	for ; i < len(glob); i++ {
+		if glob[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+// segmentMatches reports whether a single glob segment matches a path component
+func segmentMatches(seg, name string) bool {
+	re, err := regexp.Compile("^" + globRegex(seg) + "$")
+	return err == nil && re.MatchString(name)
+}
+
+// Matcher decides whether paths match a set of rules with gitignore
+// semantics: the last matching rule wins, "!" re-includes, and nothing below
+// a matched directory can be re-included. Rules come in layers of increasing
+// precedence; per-directory files of a layer are read on demand and apply to
+// their own subtree, deeper files winning.
+type Matcher struct {
+	root   string  // Context directory per-directory files are read from ("" for none)
+	layers []layer // Lowest precedence first
+
+	// include is the whitelist, if any: only paths it matches (and directories
+	// that may contain such paths) are eligible, the rules then apply on top
+	include *Matcher
+
+	mu     sync.Mutex
+	nested map[string][]*Rule // Rules of per-directory files by relative file path
+}
+
+// layer is one source of rules
+type layer struct {
+	rules    []*Rule  // Rules that apply to the whole context
+	fileName string   // Per-directory files, at the context root and below ("" for none)
+	sections []string // Sections of those files that apply (nil: the files have no sections)
+	noNegate bool     // "!pattern" is an error (nested files: skipped with a warning)
+}
+
+// checkNegations returns ErrProtectNegation for the first negated rule if the
+// layer doesn't allow them
+func (l *layer) checkNegations(rules []*Rule) error {
+	if !l.noNegate {
+		return nil
+	}
+	for _, rule := range rules {
+		if rule.Negate {
+			return fmt.Errorf("%w: %s", ErrProtectNegation, rule)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a path relative to the context root matches
+// (is ignored, protected, ...). A nil Matcher matches nothing.
+func (m *Matcher) Matches(relPath string, isDir bool) bool {
+	rule := m.Explain(relPath, isDir)
+	return rule != nil && !rule.Negate
+}
+
+// Explain returns the rule that decides a path: the last matching rule, or the
+// rule that matched one of its parent directories. A negated rule means the
+// path was re-included. Returns nil if no rule matches.
+func (m *Matcher) Explain(relPath string, isDir bool) *Rule {
+	if m == nil {
+		return nil
+	}
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	if relPath == "" || relPath == "." {
+		return nil
+	}
+
+	if m.include != nil && !m.include.eligible(relPath, isDir) {
+		return notIncluded
+	}
+
+	// A path inside a matched directory can't be re-included
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if rule := m.decide(strings.Join(parts[:i], "/"), true); rule != nil && !rule.Negate {
+			return rule
+		}
+	}
+	return m.decide(relPath, isDir)
+}
+
+// notIncluded explains paths left out by a whitelist
+var notIncluded = &Rule{Pattern: "not matched by any include pattern", Source: "include"}
+
+// eligible reports whether a whitelist lets a path through: it or a parent
+// matches (and neither it nor a parent is excluded by a negated rule), or it
+// is a directory that may contain matching paths
+func (m *Matcher) eligible(relPath string, isDir bool) bool {
+	parts := strings.Split(relPath, "/")
+	included := false
+	for i := 1; i <= len(parts); i++ {
+		rule := m.decide(strings.Join(parts[:i], "/"), i < len(parts) || isDir)
+		if rule == nil {
+			continue
+		}
+		if rule.Negate {
+			return false
+		}
+		included = true
+	}
+	if included || !isDir {
+		return included
+	}
+
+	for _, rule := range m.allRules() {
+		if !rule.Negate && len(rebase(rule.segments, parts)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// decide returns the last rule matching a path, ignoring its parents
+func (m *Matcher) decide(relPath string, isDir bool) *Rule {
+	var decided *Rule
+	for _, rule := range m.rulesFor(path.Dir(relPath)) {
+		if rule.matches(relPath, isDir) {
+			decided = rule
+		}
+	}
+	return decided
+}
+
+// rulesFor returns the rules that apply inside dir: for each layer, its
+// context-wide rules, then those of its per-directory files from the top down
+func (m *Matcher) rulesFor(dir string) []*Rule {
+	dirs := []string{""}
+	if dir != "." && dir != "" {
+		parts := strings.Split(dir, "/")
+		for i := 1; i <= len(parts); i++ {
+			dirs = append(dirs, strings.Join(parts[:i], "/"))
+		}
+	}
+
+	var rules []*Rule
+	for i := range m.layers {
+		rules = append(rules, m.layers[i].rules...)
+		for _, d := range dirs {
+			rules = append(rules, m.nestedRules(&m.layers[i], d)...)
+		}
+	}
+	return rules
+}
+
+// nestedRules reads (and caches) a layer's per-directory file in dir
+func (m *Matcher) nestedRules(l *layer, dir string) []*Rule {
+	if m.root == "" || l.fileName == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := path.Join(dir, l.fileName)
+	if rules, ok := m.nested[key]; ok {
+		return rules
+	}
+	if m.nested == nil {
+		m.nested = make(map[string][]*Rule)
+	}
+
+	file := filepath.Join(m.root, filepath.FromSlash(key))
+	rules, err := readRules(file, key, dir, l.sections)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if err := l.checkNegations(rules); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v (skipped)\n", err)
+		rules = slices.DeleteFunc(rules, func(r *Rule) bool { return r.Negate })
+	}
+	m.nested[key] = rules
+	return rules
+}
+
+// ExcludeFlags returns lftp mirror flags equivalent to the matcher for a
+// mirror rooted at subdir (relative to the context, "" for the root).
+// lftp applies --exclude/--include in order with the last match winning and
+// matches directories with a trailing slash, so rules translate one to one;
+// rules are rebased onto subdir. Nested files are found by walking the local
+// tree, skipping matched directories.
+func (m *Matcher) ExcludeFlags(subdir string) []string {
+	if m == nil {
+		return nil
+	}
+
+	var sub []string
+	if s := strings.Trim(filepath.ToSlash(subdir), "/"); s != "" && s != "." {
+		sub = strings.Split(s, "/")
+	}
+
+	var flags []string
+	seen := make(map[string]bool)
+	add := func(flag, re string) {
+		if f := flag + " " + lftpQuote(re); !seen[f] {
+			seen[f] = true
+			flags = append(flags, f)
+		}
+	}
+
+	if m.include != nil {
+		m.include.whitelistFlags(sub, add)
+	}
+
+	for _, rule := range m.allRules() {
+		for _, rest := range rebase(rule.segments, sub) {
+			if len(rest) == 0 {
+				continue // Matches subdir itself, not anything inside it
+			}
+			re := "^" + segmentsRegex(rest) + "/?$"
+			if rule.DirOnly {
+				re = "^" + segmentsRegex(rest) + "/$"
+			}
+
+			flag := "--exclude"
+			if rule.Negate {
+				// Until something is excluded there is nothing to re-include; a
+				// leading --include would also switch lftp to include-only mode
+				if len(flags) == 0 {
+					continue
+				}
+				flag = "--include"
+			}
+			add(flag, re)
+		}
+	}
+	return flags
+}
+
+// whitelistFlags adds lftp flags that exclude everything the whitelist
+// doesn't let through: all paths are excluded first, then matching paths,
+// everything inside matching directories and the directories leading to them
+// are included again. Negated rules exclude.
+func (m *Matcher) whitelistFlags(sub []string, add func(flag, re string)) {
+	// Nothing to exclude when the mirror root is included as a whole
+	if len(sub) == 0 || !m.Matches(strings.Join(sub, "/"), true) {
+		add("--exclude", "^.*$")
+	}
+
+	for _, rule := range m.allRules() {
+		for _, rest := range rebase(rule.segments, sub) {
+			if len(rest) == 0 {
+				continue
+			}
+			re := segmentsRegex(rest)
+			if rule.Negate {
+				if rule.DirOnly {
+					add("--exclude", "^"+re+"/$")
+				} else {
+					add("--exclude", "^"+re+"/?$")
+				}
+				continue
+			}
+			for k := 1; k < len(rest); k++ {
+				add("--include", "^"+segmentsRegex(rest[:k])+"/$")
+			}
+			if rule.DirOnly {
+				add("--include", "^"+re+"/.*$")
+			} else {
+				add("--include", "^"+re+"(/.*)?$")
+			}
+		}
+	}
+}
+
+// allRules returns every rule in precedence order, reading the per-directory
+// files of all directories that aren't matched themselves
+func (m *Matcher) allRules() []*Rule {
+	dirs := []string{""}
+	if m.root != "" {
+		filepath.WalkDir(m.root, func(p string, d os.DirEntry, err error) error {
+			if err != nil || !d.IsDir() || p == m.root {
+				return nil
+			}
+			rel, err := filepath.Rel(m.root, p)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			if d.Name() == ".git" || m.Matches(rel, true) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, rel)
+			return nil
+		})
+	}
+
+	var rules []*Rule
+	for i := range m.layers {
+		rules = append(rules, m.layers[i].rules...)
+		for _, d := range dirs {
+			rules = append(rules, m.nestedRules(&m.layers[i], d)...)
+		}
+	}
+	return rules
+}
+
+// rebase returns the segment lists that match p wherever subdir/p matches segs
+func rebase(segs, sub []string) [][]string {
+	if len(sub) == 0 {
+		return [][]string{segs}
+	}
+	if len(segs) == 0 {
+		return nil
+	}
+	if segs[0] == "**" {
+		// "**" matches no directories, or swallows the first one of subdir
+		return append(rebase(segs[1:], sub), rebase(segs, sub[1:])...)
+	}
+	if segmentMatches(segs[0], sub[0]) {
+		return rebase(segs[1:], sub[1:])
+	}
+	return nil
+}
+
+// lftpQuote quotes an argument for an lftp command line
+func lftpQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,549 @@
+package syncignore
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"sftp-sync/internal/config"
+)
+
+// writeTree creates files (and, for paths ending in "/", directories) below root
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for p, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		if strings.HasSuffix(p, "/") {
+			if err := os.MkdirAll(full, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// isolate keeps the user's global ignore file and git configuration out of a test
+func isolate(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+}
+
+// gitIgnored asks git whether a path of the repository at root is ignored
+func gitIgnored(t *testing.T, root, rel string) bool {
+	t.Helper()
+	cmd := exec.Command("git", "check-ignore", "-q", "--no-index", rel)
+	cmd.Dir = root
+	err := cmd.Run()
+	if err == nil {
+		return true
+	}
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		return false
+	}
+	t.Fatalf("git check-ignore %s: %v", rel, err)
+	return false
+}
+
+// conformanceRules are written both as .gitignore and as .syncignore files,
+// so every case can be checked against git
+var conformanceRules = map[string]string{
+	"": `# comment
+*.log
+!keep.log
+build/
+/root-only.txt
+docs/**/*.md
+**/cache
+a/**/z
+tmp/*
+!tmp/keep/
+\#literal
+` + "trailing.txt   \n",
+	"sub/": `*.txt
+!important.txt
+/local.dat
+`,
+}
+
+var conformanceCases = []struct {
+	path    string
+	ignored bool
+}{
+	// Unanchored patterns and negation
+	{"app.log", true},
+	{"keep.log", false},
+	{"src/x.log", true},
+	{"src/keep.log", false},
+	// Nothing inside an ignored directory can be re-included
+	{"build/keep.log", true},
+	// Directory-only patterns
+	{"build/", true},
+	{"build/out.o", true},
+	{"src/build/", true},
+	{"lib/build", false},
+	// Anchoring
+	{"root-only.txt", true},
+	{"src/root-only.txt", false},
+	// "**"
+	{"docs/a.md", true},
+	{"docs/x/y/b.md", true},
+	{"docs/a.txt", false},
+	{"other/docs/a.md", false},
+	{"cache/", true},
+	{"src/cache/file", true},
+	{"a/z", true},
+	{"a/b/c/z", true},
+	{"b/a/z", false},
+	// Re-including a directory matched by "dir/*"
+	{"tmp/foo", true},
+	{"tmp/keep/", false},
+	{"tmp/keep/f", false},
+	// Escapes and trailing spaces
+	{"#literal", true},
+	{"trailing.txt", true},
+	// Nested per-directory files apply to their own subtree
+	{"sub/notes.txt", true},
+	{"sub/important.txt", false},
+	{"sub/deep/x.txt", true},
+	{"sub/local.dat", true},
+	{"sub/deep/local.dat", false},
+	{"local.dat", false},
+	{"notes.txt", false},
+}
+
+func TestMatchesConformsToGit(t *testing.T) {
+	isolate(t)
+	root := t.TempDir()
+
+	files := map[string]string{}
+	for dir, rules := range conformanceRules {
+		files[dir+GitignoreFile] = rules
+		files[dir+FileName] = rules
+	}
+	for _, c := range conformanceCases {
+		files[c.path] = "x"
+	}
+	writeTree(t, root, files)
+
+	_, gitErr := exec.LookPath("git")
+	if gitErr == nil {
+		cmd := exec.Command("git", "init", "-q")
+		cmd.Dir = root
+		if err := cmd.Run(); err != nil {
+			gitErr = err
+		}
+	}
+
+	m, err := ForProfile(&config.Profile{Context: root}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range conformanceCases {
+		rel := strings.TrimSuffix(c.path, "/")
+		isDir := strings.HasSuffix(c.path, "/")
+		if got := m.Matches(rel, isDir); got != c.ignored {
+			t.Errorf("Matches(%q, %v) = %v, want %v", rel, isDir, got, c.ignored)
+		}
+		if gitErr == nil {
+			if git := gitIgnored(t, root, rel); git != c.ignored {
+				t.Errorf("table says %q ignored=%v, git says %v", c.path, c.ignored, git)
+			}
+		}
+	}
+	if gitErr != nil {
+		t.Logf("git not available, table not checked against git: %v", gitErr)
+	}
+}
+
+// patternOf strips the flag and lftp quoting from an ExcludeFlags entry
+func patternOf(t *testing.T, flag string) string {
+	t.Helper()
+	_, quoted, ok := strings.Cut(flag, " ")
+	if !ok || len(quoted) < 2 || quoted[0] != '\'' || quoted[len(quoted)-1] != '\'' {
+		t.Fatalf("malformed flag %q", flag)
+	}
+	return strings.ReplaceAll(quoted[1:len(quoted)-1], `'\''`, "'")
+}
+
+// checkPOSIX fails if lftp (regcomp with REG_EXTENDED) couldn't compile a flag's pattern
+func checkPOSIX(t *testing.T, flags []string) {
+	t.Helper()
+	for _, f := range flags {
+		if _, err := regexp.CompilePOSIX(patternOf(t, f)); err != nil {
+			t.Errorf("%s is not a POSIX extended regex: %v", f, err)
+		}
+	}
+}
+
+func TestExcludeFlags(t *testing.T) {
+	isolate(t)
+
+	tests := []struct {
+		name   string
+		rules  string
+		subdir string
+		want   []string
+	}{
+		{
+			name:  "unanchored file pattern",
+			rules: "*.log\n",
+			want: []string{
+				`--exclude '^(.*/)?[^/]*\.log/?$'`,
+				`--exclude '^(.*/)?\.syncignore/?$'`,
+				`--exclude '^(.*/)?\.syncinclude/?$'`,
+			},
+		},
+		{
+			name:  "anchored directory, negation and double star",
+			rules: "/build/\ndocs/**/*.md\n!docs/keep.md\n",
+			want: []string{
+				`--exclude '^build/$'`,
+				`--exclude '^docs/(.*/)?[^/]*\.md/?$'`,
+				`--include '^docs/keep\.md/?$'`,
+				`--exclude '^(.*/)?\.syncignore/?$'`,
+				`--exclude '^(.*/)?\.syncinclude/?$'`,
+			},
+		},
+		{
+			name:   "rebased onto a subdirectory",
+			rules:  "/build/\ndocs/**/*.md\nsrc/*.tmp\n",
+			subdir: "docs",
+			want: []string{
+				`--exclude '^(.*/)?[^/]*\.md/?$'`,
+				`--exclude '^(.*/)?\.syncignore/?$'`,
+				`--exclude '^(.*/)?\.syncinclude/?$'`,
+			},
+		},
+		{
+			name:  "leading negation is dropped",
+			rules: "!keep\n*.bak\n",
+			want: []string{
+				`--exclude '^(.*/)?[^/]*\.bak/?$'`,
+				`--exclude '^(.*/)?\.syncignore/?$'`,
+				`--exclude '^(.*/)?\.syncinclude/?$'`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, map[string]string{FileName: tt.rules})
+
+			m, err := ForProfile(&config.Profile{Context: root}, Up)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := m.ExcludeFlags(tt.subdir)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("ExcludeFlags(%q) =\n%s\nwant\n%s", tt.subdir, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			checkPOSIX(t, got)
+		})
+	}
+}
+
+func TestExcludeFlagsArePOSIX(t *testing.T) {
+	isolate(t)
+	root := t.TempDir()
+	files := map[string]string{}
+	for dir, rules := range conformanceRules {
+		files[dir+FileName] = rules
+	}
+	writeTree(t, root, files)
+
+	m, err := ForProfile(&config.Profile{Context: root}, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subdir := range []string{"", "sub", "docs/x"} {
+		checkPOSIX(t, m.ExcludeFlags(subdir))
+	}
+
+	protect, err := ProtectForProfile(&config.Profile{Context: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPOSIX(t, protect.ExcludeFlags(""))
+}
+
+func TestForProfileLayers(t *testing.T) {
+	isolate(t)
+	repo := t.TempDir()
+	context := filepath.Join(repo, "site")
+	writeTree(t, repo, map[string]string{
+		GitignoreFile:               "*.tmp\n/site/generated/\n",
+		"site/" + GitignoreFile:     "*.cache\n",
+		"site/sub/" + GitignoreFile: "*.out\n",
+		"site/" + FileName:          "!keep.tmp\n!keep.bak\n",
+		"site/generated/":           "",
+		"site/secret/":              "",
+	})
+	global, err := config.GetGlobalIgnorePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, filepath.Dir(global), map[string]string{filepath.Base(global): "*.bak\n[down]\n*.dl\n"})
+
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = repo
+	if err := cmd.Run(); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	writeTree(t, repo, map[string]string{".git/info/exclude": "*.swp\n"})
+
+	profile := &config.Profile{
+		Context:       context,
+		UseGitignore:  true,
+		Exclude:       []string{"secret/"},
+		MappingIgnore: []string{"*.map"},
+	}
+
+	tests := []struct {
+		path    string
+		dir     Direction
+		ignored bool
+		source  string // Source of the deciding rule ("" for none)
+		fromGit bool   // Decided by git's own files, so git must agree
+	}{
+		{"a.tmp", Up, true, "/.gitignore", true},
+		{"generated/", Up, true, "/.gitignore", true},
+		{"x.swp", Up, true, ".git/info/exclude", true},
+		{"y.cache", Up, true, ".gitignore", true},
+		{"sub/z.out", Up, true, "sub/.gitignore", true},
+		{"z.out", Up, false, "", true},
+		// .syncignore overrides .gitignore and the global file
+		{"keep.tmp", Up, false, FileName, false},
+		{"keep.bak", Up, false, FileName, false},
+		{"b.bak", Up, true, global, false},
+		// Global file sections
+		{"c.dl", Up, false, "", false},
+		{"c.dl", Down, true, global, false},
+		// Profile patterns
+		{"secret/", Up, true, "config (exclude)", false},
+		{"m.map", Up, true, "config (mapping ignore)", false},
+	}
+
+	for _, tt := range tests {
+		m, err := ForProfile(profile, tt.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel := strings.TrimSuffix(tt.path, "/")
+		isDir := strings.HasSuffix(tt.path, "/")
+
+		rule := m.Explain(rel, isDir)
+		ignored := rule != nil && !rule.Negate
+		if ignored != tt.ignored {
+			t.Errorf("%s %s: ignored = %v, want %v (rule %v)", tt.dir, tt.path, ignored, tt.ignored, rule)
+		}
+		source := ""
+		if rule != nil {
+			source = rule.Source
+		}
+		if source != tt.source {
+			t.Errorf("%s %s: decided by %q, want %q", tt.dir, tt.path, source, tt.source)
+		}
+		if tt.fromGit {
+			if git := gitIgnored(t, repo, "site/"+rel); git != tt.ignored {
+				t.Errorf("%s: git says ignored=%v", tt.path, git)
+			}
+		}
+	}
+
+	// Without useGitignore only sftp-sync's own sources count
+	profile.UseGitignore = false
+	m, err := ForProfile(profile, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a.tmp", "x.swp", "y.cache"} {
+		if m.Matches(p, false) {
+			t.Errorf("%s ignored without useGitignore", p)
+		}
+	}
+}
+
+func TestWhitelist(t *testing.T) {
+	isolate(t)
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		IncludeFileName: "src/\n*.md\n!src/vendor/\n",
+		FileName:        "*.log\n",
+	})
+	profile := &config.Profile{Context: root, Include: []string{"/public/index.html"}}
+
+	m, err := ForProfile(profile, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"src/", false},
+		{"src/a.go", false},
+		{"src/deep/b.go", false},
+		{"lib/a.go", true},
+		{"README.md", false},
+		{"lib/x.md", false},
+		{"lib/", false}, // May contain *.md files
+		{"src/vendor/", true},
+		{"src/vendor/x.go", true},
+		{"public/", false},
+		{"public/index.html", false},
+		{"public/other.html", true},
+		// Ignore rules apply on top
+		{"src/a.log", true},
+	}
+	for _, tt := range tests {
+		rel := strings.TrimSuffix(tt.path, "/")
+		if got := m.Matches(rel, strings.HasSuffix(tt.path, "/")); got != tt.ignored {
+			t.Errorf("Matches(%q) = %v, want %v", tt.path, got, tt.ignored)
+		}
+	}
+
+	if rule := m.Explain("lib/a.go", false); rule != notIncluded {
+		t.Errorf("lib/a.go decided by %v, want %v", rule, notIncluded)
+	}
+
+	want := []string{
+		`--exclude '^.*$'`,
+		`--include '^.+/$'`, // Any directory may contain a src/ or *.md
+		`--include '^(.*/)?src/.*$'`,
+		`--include '^(.*/)?[^/]*\.md(/.*)?$'`,
+		`--exclude '^src/vendor/$'`,
+		`--include '^public/$'`,
+		`--include '^public/index\.html(/.*)?$'`,
+		`--exclude '^(.*/)?[^/]*\.log/?$'`,
+		`--exclude '^(.*/)?\.syncignore/?$'`,
+		`--exclude '^(.*/)?\.syncinclude/?$'`,
+	}
+	got := m.ExcludeFlags("")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ExcludeFlags =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	checkPOSIX(t, got)
+
+	// A fully included subdirectory needs no catch-all exclude
+	got = m.ExcludeFlags("src")
+	if len(got) > 0 && got[0] == `--exclude '^.*$'` {
+		t.Errorf("ExcludeFlags(src) excludes everything: %v", got)
+	}
+	checkPOSIX(t, got)
+}
+
+// lftpExcluded evaluates mirror flags the way lftp does: the last matching
+// flag wins, and nothing inside an excluded directory is visited
+func lftpExcluded(t *testing.T, flags []string, relPath string, isDir bool) bool {
+	t.Helper()
+	parts := strings.Split(relPath, "/")
+	for i := 1; i <= len(parts); i++ {
+		p := strings.Join(parts[:i], "/")
+		if i < len(parts) || isDir {
+			p += "/"
+		}
+		excluded := false
+		for _, f := range flags {
+			if regexp.MustCompilePOSIX(patternOf(t, f)).MatchString(p) {
+				excluded = strings.HasPrefix(f, "--exclude")
+			}
+		}
+		if excluded {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProtectAgreesWithUp(t *testing.T) {
+	isolate(t)
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		FileName:          "*.log\n[protect]\nuploads/*\ncache/\n",
+		"sub/" + FileName: "[protect]\n*.bak\n!keep.bak\n", // Negation skipped with a warning
+		"uploads/":        "",
+		"sub/":            "",
+		"sub/deeper/":     "",
+	})
+	profile := &config.Profile{Context: root, Protect: []string{"/robots.txt"}}
+
+	ignore, err := ForProfile(profile, Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protect, err := ProtectForProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What up's mirror skips (ignore rules, then protect rules) must be what
+	// push, restore and the daemon refuse (CheckProtected), for every path
+	// that isn't ignored anyway
+	flags := append(ignore.ExcludeFlags(""), protect.ExcludeFlags("")...)
+	tests := []struct {
+		path      string
+		protected bool
+	}{
+		{"index.html", false},
+		{"robots.txt", true},
+		{"uploads/a.jpg", true},
+		{"uploads/index.html", true},
+		{"cache/", true},
+		{"cache/x/y.html", true},
+		{".ftpquota", true},
+		{"sub/a.bak", true},
+		{"sub/keep.bak", true},
+		{"sub/deeper/b.bak", true},
+		{"sub/a.txt", false},
+	}
+	for _, tt := range tests {
+		rel := strings.TrimSuffix(tt.path, "/")
+		isDir := strings.HasSuffix(tt.path, "/")
+		if ignore.Matches(rel, isDir) {
+			t.Fatalf("%s is ignored; the case tests nothing", tt.path)
+		}
+		if got := protect.Matches(rel, isDir); got != tt.protected {
+			t.Errorf("protect.Matches(%q) = %v, want %v", tt.path, got, tt.protected)
+		}
+		if got := lftpExcluded(t, flags, rel, isDir); got != tt.protected {
+			t.Errorf("up excludes %q = %v, want %v", tt.path, got, tt.protected)
+		}
+	}
+}
+
+func TestProtectRejectsNegation(t *testing.T) {
+	isolate(t)
+
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{FileName: "[protect]\nuploads/*\n!uploads/index.html\n"})
+	if _, err := ProtectForProfile(&config.Profile{Context: root}); !errors.Is(err, ErrProtectNegation) {
+		t.Errorf(".syncignore negation: err = %v, want %v", err, ErrProtectNegation)
+	}
+
+	// Negations in other sections are fine
+	root = t.TempDir()
+	writeTree(t, root, map[string]string{FileName: "*.log\n!keep.log\n[protect]\nuploads/\n"})
+	if _, err := ProtectForProfile(&config.Profile{Context: root}); err != nil {
+		t.Errorf("negation outside [protect]: %v", err)
+	}
+
+	profile := &config.Profile{Context: t.TempDir(), Protect: []string{"uploads/*", "!uploads/index.html"}}
+	if _, err := ProtectForProfile(profile); !errors.Is(err, ErrProtectNegation) {
+		t.Errorf("config negation: err = %v, want %v", err, ErrProtectNegation)
+	}
+}
@@ -2,149 +2,284 @@ package syncignore
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
-	"github.com/bmatcuk/doublestar/v4"
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/gitrepo"
 )
 
-// Load reads and parses a .syncignore file from the given context directory.
-// Returns a slice of patterns to ignore.
-// If the file doesn't exist, returns an empty slice (no ignore rules).
-// Malformed patterns are logged as errors and skipped.
-func Load(contextPath string) ([]string, error) {
-	syncignorePath := filepath.Join(contextPath, ".syncignore")
+// Direction selects which direction-specific .syncignore patterns apply
+type Direction string
 
-	// Check if .syncignore exists
-	if _, err := os.Stat(syncignorePath); os.IsNotExist(err) {
-		// No .syncignore file - no ignore rules
-		return []string{}, nil
-	}
+const (
+	Up   Direction = "up"   // Uploads: up, push, current and the daemon
+	Down Direction = "down" // Downloads: down and pull
+)
+
+// .syncignore sections. Patterns before the first header belong to [both].
+const (
+	SectionBoth    = "both"    // Ignored in both directions
+	SectionUp      = "up"      // Ignored by uploads only
+	SectionDown    = "down"    // Ignored by downloads only
+	SectionProtect = "protect" // Remote paths uploads must never delete or overwrite
+)
+
+// ErrProtectNegation means a protect list has a "!pattern". lftp can't
+// re-include a protected path without also re-including ignored ones, so up
+// and single-file uploads would disagree about it.
+var ErrProtectNegation = errors.New("negated patterns are not supported in protect lists")
+
+// DefaultProtect lists remote paths that are protected without any configuration.
+// .ftpquota is maintained by cPanel servers and can't be overwritten or deleted.
+var DefaultProtect = []string{".ftpquota"}
+
+// FileName is the name of ignore files, at the context root and in any subdirectory
+const FileName = ".syncignore"
+
+// sections are the [name] headers recognised in .syncignore
+var sections = map[string]bool{
+	SectionBoth:    true,
+	SectionUp:      true,
+	SectionDown:    true,
+	SectionProtect: true,
+}
 
-	file, err := os.Open(syncignorePath)
+// IncludeFileName is the name of the whitelist file at the context root
+const IncludeFileName = ".syncinclude"
+
+// GitignoreFile is the name of git's per-directory ignore files
+const GitignoreFile = ".gitignore"
+
+// readRules reads the patterns of the given sections from an ignore file, in
+// file order. base is the directory of the file relative to the context
+// ("" for the root) and source names the file in rule descriptions. With no
+// sections (nil), the file has no headers and every pattern applies.
+// Returns an os.IsNotExist error if the file is missing.
+func readRules(file, source, base string, want []string) ([]*Rule, error) {
+	f, err := os.Open(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open .syncignore: %w", err)
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", file, err)
 	}
-	defer file.Close()
+	defer f.Close()
 
-	var patterns []string
-	scanner := bufio.NewScanner(file)
+	var rules []*Rule
+	section := SectionBoth
+	scanner := bufio.NewScanner(f)
 	lineNum := 0
 
 	for scanner.Scan() {
 		lineNum++
-		line := strings.TrimSpace(scanner.Text())
+		line := scanner.Text()
 
-		// Skip empty lines
-		if line == "" {
-			continue
-		}
+		if want != nil {
+			// Section header (anything else in brackets is a glob pattern)
+			if name, ok := strings.CutPrefix(strings.TrimSpace(line), "["); ok {
+				if name, ok := strings.CutSuffix(name, "]"); ok && sections[name] {
+					section = name
+					continue
+				}
+			}
 
-		// Skip comments
-		if strings.HasPrefix(line, "#") {
-			continue
+			if !slices.Contains(want, section) {
+				continue
+			}
 		}
-
-		// Validate pattern (basic check - doublestar will validate during matching)
-		// Just ensure it's not obviously malformed
-		if strings.Contains(line, "***") {
-			fmt.Fprintf(os.Stderr, "Warning: Invalid pattern '%s' in .syncignore line %d (skipping)\n", line, lineNum)
-			continue
+		if rule := newRule(line, base, source, lineNum); rule != nil {
+			rules = append(rules, rule)
 		}
-
-		patterns = append(patterns, line)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read .syncignore: %w", err)
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
 	}
 
-	// Always add .syncignore itself
-	patterns = append(patterns, ".syncignore")
-
-	return patterns, nil
+	return rules, nil
 }
 
-// ShouldIgnore checks if a relative file path matches any ignore pattern.
-// relativePath should be relative to the context directory.
-// Returns true if the file should be ignored, false otherwise.
-func ShouldIgnore(relativePath string, patterns []string) bool {
-	// Normalize path separators
-	relativePath = filepath.ToSlash(relativePath)
-
-	for _, pattern := range patterns {
-		// Normalize pattern
-		pattern = filepath.ToSlash(pattern)
-
-		// Try matching with doublestar
-		matched, err := doublestar.Match(pattern, relativePath)
-		if err != nil {
-			// Pattern is malformed - log and skip
-			fmt.Fprintf(os.Stderr, "Warning: Invalid glob pattern '%s': %v\n", pattern, err)
+// newMatcher builds a matcher over the given layers, lowest precedence first.
+// The root files of the layers are read up front so errors are reported.
+func newMatcher(contextPath string, layers ...layer) (*Matcher, error) {
+	m := &Matcher{root: contextPath, layers: layers, nested: make(map[string][]*Rule)}
+	for _, l := range layers {
+		if err := l.checkNegations(l.rules); err != nil {
+			return nil, err
+		}
+		if l.fileName == "" {
 			continue
 		}
-
-		if matched {
-			return true
+		rules, err := readRules(filepath.Join(contextPath, l.fileName), l.fileName, "", l.sections)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
 		}
-
-		// Also check if pattern matches with ** prefix for files anywhere
-		// e.g., "*.log" should match "foo/bar/test.log"
-		if !strings.HasPrefix(pattern, "**/") && !strings.HasPrefix(pattern, "/") {
-			globalPattern := "**/" + pattern
-			matched, err := doublestar.Match(globalPattern, relativePath)
-			if err == nil && matched {
-				return true
-			}
+		if err := l.checkNegations(rules); err != nil {
+			return nil, err
 		}
+		m.nested[l.fileName] = rules
+	}
+	return m, nil
+}
 
-		// Handle directory patterns (trailing slash)
-		if strings.HasSuffix(pattern, "/") {
-			// Check if file is inside this directory
-			dirPattern := strings.TrimSuffix(pattern, "/")
-			if strings.HasPrefix(relativePath, dirPattern+"/") {
-				return true
-			}
-			// Also check with ** prefix
-			if !strings.HasPrefix(dirPattern, "**/") && !strings.HasPrefix(dirPattern, "/") {
-				globalDirPattern := "**/" + dirPattern
-				if strings.HasPrefix(relativePath, globalDirPattern+"/") {
-					return true
-				}
-			}
+// patternRules compiles patterns that aren't read from a file, relative to the context root
+func patternRules(patterns []string, source string) []*Rule {
+	var rules []*Rule
+	for _, p := range patterns {
+		if rule := newRule(p, "", source, 0); rule != nil {
+			rules = append(rules, rule)
 		}
+	}
+	return rules
+}
 
-		// Handle root-only patterns (leading slash)
-		if strings.HasPrefix(pattern, "/") {
-			rootPattern := strings.TrimPrefix(pattern, "/")
-			if relativePath == rootPattern {
-				return true
-			}
+// globalLayer reads the given sections of the user-global ignore file
+func globalLayer(want []string) (layer, error) {
+	file, err := config.GetGlobalIgnorePath()
+	if err != nil {
+		return layer{}, nil // No home directory, no global file
+	}
+	rules, err := readRules(file, file, "", want)
+	if err != nil && !os.IsNotExist(err) {
+		return layer{}, err
+	}
+	return layer{rules: rules}, nil
+}
+
+// gitignoreLayer reads git's ignore rules for contextPath: .git/info/exclude
+// and the .gitignore files from the repository root down to the context are
+// loaded up front (rebased onto the context), the ones below it on demand.
+func gitignoreLayer(contextPath string) (layer, error) {
+	l := layer{fileName: GitignoreFile}
+
+	repo := gitrepo.Open(contextPath)
+	if repo == nil {
+		return l, nil
+	}
+
+	// Path of the context inside the repository
+	absContext, err := filepath.Abs(contextPath)
+	if err != nil {
+		return l, nil
+	}
+	if resolved, err := filepath.EvalSymlinks(absContext); err == nil {
+		absContext = resolved
+	}
+	rel, err := filepath.Rel(repo.Root, absContext)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return l, nil
+	}
+	var sub []string
+	if rel != "." {
+		sub = strings.Split(filepath.ToSlash(rel), "/")
+	}
+
+	var files, sources, bases []string
+	if exclude, err := repo.GitPath("info/exclude"); err == nil {
+		files = append(files, exclude)
+		sources = append(sources, ".git/info/exclude")
+		bases = append(bases, "")
+	}
+	for i := range sub {
+		dir := strings.Join(sub[:i], "/")
+		files = append(files, filepath.Join(repo.Root, filepath.FromSlash(dir), GitignoreFile))
+		sources = append(sources, path.Join("/", dir, GitignoreFile))
+		bases = append(bases, dir)
+	}
+
+	for i, file := range files {
+		rules, err := readRules(file, sources[i], bases[i], nil)
+		if err != nil && !os.IsNotExist(err) {
+			return l, err
+		}
+		for _, rule := range rules {
+			l.rules = append(l.rules, rule.rebased(sub)...)
 		}
 	}
+	return l, nil
+}
 
-	return false
+// includeForProfile loads the whitelist of a profile in the given direction:
+// the .syncinclude file at the context root plus the profile's include
+// patterns. Returns nil if there are none.
+func includeForProfile(profile *config.Profile, want []string) (*Matcher, error) {
+	rules, err := readRules(filepath.Join(profile.Context, IncludeFileName), IncludeFileName, "", want)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	rules = append(rules, patternRules(profile.Include, "config (include)")...)
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return newMatcher("", layer{rules: rules})
 }
 
-// BuildExcludeFlags generates lftp exclude flags from patterns.
-// Returns a slice of flags like ["--exclude", ".git", "--exclude-glob", "*.log"]
-func BuildExcludeFlags(patterns []string) []string {
-	var flags []string
-
-	for _, pattern := range patterns {
-		// Normalize pattern
-		pattern = filepath.ToSlash(pattern)
-
-		// If pattern contains wildcards, use --exclude-glob
-		if strings.ContainsAny(pattern, "*?[]") {
-			flags = append(flags, "--exclude-glob", pattern)
-		} else {
-			// Otherwise use simple --exclude
-			flags = append(flags, "--exclude", pattern)
+// ForProfile loads the ignore rules for a profile in the given direction.
+// Sources, from lowest to highest precedence (the last matching rule wins):
+//
+//  1. the user-global ignore file (~/.config/sftp-sync/ignore)
+//  2. with useGitignore, .git/info/exclude and the .gitignore files
+//  3. the profile's exclude patterns
+//  4. the .syncignore files of the context, nested ones applying to their subtree
+//  5. the ignore patterns of the mapping the profile is scoped to
+//
+// The ignore and .syncignore files use the [both] section (and anything
+// before the first header) plus the [up] or [down] section. Every pattern has
+// gitignore semantics. .syncignore and .syncinclude files are always ignored.
+//
+// With a .syncinclude file or include patterns, only paths they match are
+// eligible; the rules above then apply on top.
+func ForProfile(profile *config.Profile, dir Direction) (*Matcher, error) {
+	want := []string{SectionBoth, string(dir)}
+
+	include, err := includeForProfile(profile, want)
+	if err != nil {
+		return nil, err
+	}
+
+	global, err := globalLayer(want)
+	if err != nil {
+		return nil, err
+	}
+	layers := []layer{global}
+
+	if profile.UseGitignore {
+		gitignore, err := gitignoreLayer(profile.Context)
+		if err != nil {
+			return nil, err
 		}
+		layers = append(layers, gitignore)
+	}
+
+	layers = append(layers,
+		layer{rules: patternRules(profile.Exclude, "config (exclude)")},
+		layer{fileName: FileName, sections: want},
+		layer{rules: append(
+			patternRules(profile.MappingIgnore, "config (mapping ignore)"),
+			patternRules([]string{FileName, IncludeFileName}, "built-in")...)},
+	)
+
+	m, err := newMatcher(profile.Context, layers...)
+	if err != nil {
+		return nil, err
 	}
+	m.include = include
+	return m, nil
+}
 
-	return flags
+// ProtectForProfile loads the remote paths uploads must never delete or
+// overwrite: the defaults, the [protect] sections of .syncignore files and the
+// profile's protect list. Paths are relative to the remote path. Negated
+// patterns fail with ErrProtectNegation.
+func ProtectForProfile(profile *config.Profile) (*Matcher, error) {
+	return newMatcher(profile.Context,
+		layer{rules: patternRules(DefaultProtect, "default"), noNegate: true},
+		layer{fileName: FileName, sections: []string{SectionProtect}, noNegate: true},
+		layer{rules: patternRules(profile.Protect, "config (protect)"), noNegate: true})
 }
@@ -0,0 +1,99 @@
+package syncstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"sftp-sync/internal/state"
+)
+
+const (
+	incomingDir = "incoming"
+)
+
+// incoming is a manual download in progress
+type incoming struct {
+	PID   int      `json:"pid"`
+	Paths []string `json:"paths"` // absolute local files or directories it writes
+}
+
+// Expect announces that this process is about to write local paths (files
+// or directories) of a profile, so a running daemon doesn't upload them
+// back. The returned function withdraws the announcement.
+func Expect(profileName string, absPaths ...string) (func(), error) {
+	p, err := state.Path(stateDir, incomingDir, fmt.Sprintf("%s.%d.json", profileName, os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(incoming{PID: os.Getpid(), Paths: absPaths})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to announce download: %w", err)
+	}
+	return func() { os.Remove(p) }, nil
+}
+
+// Expected reports whether a running process announced it is writing
+// absPath. Announcements of processes that died are cleaned up.
+func Expected(profileName, absPath string) bool {
+	dir, err := state.Path(stateDir, incomingDir)
+	if err != nil {
+		return false
+	}
+	entries, _ := os.ReadDir(dir)
+
+	for _, e := range entries {
+		if !announcedFor(e.Name(), profileName) {
+			continue
+		}
+		f := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var in incoming
+		if json.Unmarshal(data, &in) != nil || !alive(in.PID) {
+			os.Remove(f)
+			continue
+		}
+		for _, p := range in.Paths {
+			if absPath == p || strings.HasPrefix(absPath, p+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// announcedFor reports whether a file in the incoming directory is an
+// announcement of the profile: "<profile>.<pid>.json". Other profiles' names
+// may start with "<profile>." too.
+func announcedFor(name, profileName string) bool {
+	rest, ok := strings.CutPrefix(name, profileName+".")
+	if !ok {
+		return false
+	}
+	pid, ok := strings.CutSuffix(rest, ".json")
+	if !ok || pid == "" {
+		return false
+	}
+	for _, c := range pid {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// alive reports whether a process exists
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
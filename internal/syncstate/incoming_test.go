@@ -0,0 +1,25 @@
+package syncstate
+
+import "testing"
+
+func TestAnnouncedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    bool
+	}{
+		{"web.1234.json", "web", true},
+		{"web.staging.1234.json", "web", false},
+		{"web.staging.1234.json", "web.staging", true},
+		{"webshop.1234.json", "web", false},
+		{"web..json", "web", false},
+		{"web.1234.json.tmp", "web", false},
+		{"[web].1234.json", "[web]", true},
+		{"w.1234.json", "[web]", false},
+	}
+	for _, tt := range tests {
+		if got := announcedFor(tt.name, tt.profile); got != tt.want {
+			t.Errorf("announcedFor(%q, %q) = %v, want %v", tt.name, tt.profile, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package syncstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sftp-sync/internal/state"
+)
+
+const (
+	stateDir = "syncstate"
+)
+
+// File is the last-synced version of a local file
+type File struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modTime"`
+	SyncedAt time.Time `json:"syncedAt"`
+}
+
+// State records the last-synced version of each local file of a profile, so
+// changes made while nothing was watching can be found later
+type State struct {
+	Files map[string]File `json:"files"` // absolute local path -> version
+}
+
+// mu serializes updates within the process (the daemon updates from several goroutines)
+var mu sync.Mutex
+
+// statePath returns the state file of a profile
+func statePath(profileName string) (string, error) {
+	return state.Path(stateDir, profileName+".json")
+}
+
+// Load reads the sync state of a profile. A profile that was never synced
+// has an empty state.
+func Load(profileName string) (*State, error) {
+	p, err := statePath(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{Files: make(map[string]File)}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %w", p, err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]File)
+	}
+	return s, nil
+}
+
+// save writes the sync state of a profile atomically
+func (s *State) save(profileName string) error {
+	p, err := statePath(profileName)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+// Update loads the sync state of a profile, applies fn and saves it
+func Update(profileName string, fn func(s *State)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, err := Load(profileName)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	return s.save(profileName)
+}
+
+// Record marks files as synced in their current version. Files that don't
+// exist (any more) are forgotten.
+func Record(profileName string, absPaths ...string) error {
+	return Update(profileName, func(s *State) {
+		for _, p := range absPaths {
+			s.Record(p)
+		}
+	})
+}
+
+// Record marks a file as synced in its current version
+func (s *State) Record(absPath string) {
+	info, err := os.Stat(absPath)
+	if err != nil || info.IsDir() {
+		s.Forget(absPath)
+		return
+	}
+	s.Files[absPath] = File{Size: info.Size(), ModTime: info.ModTime(), SyncedAt: time.Now()}
+}
+
+// Forget drops a file, or a directory and everything below it
+func (s *State) Forget(absPath string) {
+	for p := range s.Files {
+		if p == absPath || strings.HasPrefix(p, absPath+"/") {
+			delete(s.Files, p)
+		}
+	}
+}
+
+// Rename moves the entries of a renamed file or directory to its new path
+func (s *State) Rename(oldPath, newPath string) {
+	moved := make(map[string]File)
+	for p, f := range s.Files {
+		if p == oldPath || strings.HasPrefix(p, oldPath+"/") {
+			delete(s.Files, p)
+			moved[newPath+strings.TrimPrefix(p, oldPath)] = f
+		}
+	}
+	for p, f := range moved {
+		s.Files[p] = f
+	}
+}
+
+// Changed reports whether a local file differs from its last-synced version
+// (or was never synced)
+func (s *State) Changed(absPath string, info os.FileInfo) bool {
+	f, ok := s.Files[absPath]
+	return !ok || f.Size != info.Size() || !f.ModTime.Equal(info.ModTime())
+}
+
+// Synced reports whether a file was ever recorded as synced
+func (s *State) Synced(absPath string) bool {
+	_, ok := s.Files[absPath]
+	return ok
+}
+
+// SyncedSince reports whether a file was recorded as synced after t
+func (s *State) SyncedSince(absPath string, t time.Time) bool {
+	f, ok := s.Files[absPath]
+	return ok && f.SyncedAt.After(t)
+}
+
+// Within returns the recorded files below a local directory
+func (s *State) Within(dir string) []string {
+	dir = filepath.Clean(dir)
+	var files []string
+	for p := range s.Files {
+		if strings.HasPrefix(p, dir+"/") {
+			files = append(files, p)
+		}
+	}
+	return files
+}
@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/syncignore"
+	"sftp-sync/internal/syncstate"
+)
+
+// CatchUp queues the changes made to a profile's files while nothing was
+// watching them. Files are compared with the last-synced state; mappings that
+// were never synced are compared with the remote instead, and the files that
+// already match it become the baseline. Caught-up changes don't notify one
+// by one. Returns the number of queued changes; download-only profiles have
+// none.
+func CatchUp(profileName string, profile *config.Profile, queue *UploadQueue) (int, error) {
+	if profile.DownloadOnly() {
+		return 0, nil
+	}
+
+	st, err := syncstate.Load(profileName)
+	if err != nil {
+		return 0, err
+	}
+
+	var changes []Change
+	var baseline, forget []string
+	for _, m := range profile.GetMappings() {
+		scoped := profile.ForMapping(m)
+		files, err := lftp.ListLocal(scoped, "", syncignore.Up)
+		if err != nil {
+			return 0, err
+		}
+
+		known := st.Within(m.Local)
+		if len(known) == 0 {
+			// Never synced: whatever `up` would transfer is out of date
+			ops, err := lftp.PlanUp(scoped, "")
+			if err != nil {
+				return 0, err
+			}
+			pending := make(map[string]bool)
+			for _, op := range ops {
+				if op.Action == lftp.ActionUpload {
+					pending[op.Path] = true
+				}
+			}
+			for _, rel := range files {
+				absFile := filepath.Join(m.Local, rel)
+				if pending[rel] {
+					changes = append(changes, Change{Op: OpUpload, Path: absFile})
+				} else {
+					baseline = append(baseline, absFile)
+				}
+			}
+			continue
+		}
+
+		for _, rel := range files {
+			absFile := filepath.Join(m.Local, rel)
+			if info, err := os.Stat(absFile); err == nil && st.Changed(absFile, info) {
+				changes = append(changes, Change{Op: OpUpload, Path: absFile})
+			}
+		}
+		for _, absFile := range known {
+			if _, err := os.Lstat(absFile); !os.IsNotExist(err) {
+				continue
+			}
+			if profile.AutoSyncDelete {
+				changes = append(changes, Change{Op: OpDelete, Path: absFile})
+			} else {
+				forget = append(forget, absFile)
+			}
+		}
+	}
+
+	if len(baseline) > 0 || len(forget) > 0 {
+		err := syncstate.Update(profileName, func(s *syncstate.State) {
+			for _, p := range baseline {
+				s.Record(p)
+			}
+			for _, p := range forget {
+				s.Forget(p)
+			}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to update sync state: %v\n", err)
+		}
+	}
+
+	for _, change := range changes {
+		change.Quiet = true
+		queue.Enqueue(profileName, change)
+	}
+	return len(changes), nil
+}
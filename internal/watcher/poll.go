@@ -0,0 +1,213 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"sftp-sync/internal/config"
+)
+
+// Filesystem magic numbers (statfs f_type) where inotify doesn't see changes
+// made by other machines, or doesn't fire at all
+var remoteFilesystems = map[int64]string{
+	0x6969:     "NFS",
+	0xFF534D42: "CIFS",
+	0xFE534D42: "SMB2",
+	0x517B:     "SMB",
+	0x65735546: "FUSE",
+}
+
+// remoteFilesystem returns the name of the network or FUSE filesystem dir is
+// on, or "" for local filesystems
+func remoteFilesystem(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	return remoteFilesystems[int64(st.Type)]
+}
+
+// polledFile is what a scan remembers about a file
+type polledFile struct {
+	size    int64
+	modTime time.Time
+	inode   uint64
+}
+
+// poller notices changes to a profile's files by scanning them on an interval
+type poller struct {
+	w           *Watcher
+	profileName string
+	profile     *config.Profile
+	files       map[string]polledFile
+	stop        chan struct{}
+}
+
+// startPoller starts scanning a profile's mappings. The first scan only
+// records the current state (the daemon's catch-up handles older changes).
+func (w *Watcher) startPoller(profileName string, profile *config.Profile) {
+	p := &poller{
+		w:           w,
+		profileName: profileName,
+		profile:     profile,
+		stop:        make(chan struct{}),
+	}
+	p.files = p.scan()
+
+	w.mu.Lock()
+	w.pollers[profileName] = p
+	w.mu.Unlock()
+
+	interval := time.Duration(profile.PollInterval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second // Default 5s
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.poll()
+			}
+		}
+	}()
+}
+
+// stopPoller stops scanning a profile. Returns whether it was being polled.
+func (w *Watcher) stopPoller(profileName string) bool {
+	w.mu.Lock()
+	p, ok := w.pollers[profileName]
+	delete(w.pollers, profileName)
+	w.mu.Unlock()
+
+	if ok {
+		close(p.stop)
+	}
+	return ok
+}
+
+// polled reports whether a profile is watched by polling
+func (w *Watcher) polled(profileName string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.pollers[profileName]
+	return ok
+}
+
+// scan lists the files of the profile's mappings, skipping ignored directories
+func (p *poller) scan() map[string]polledFile {
+	profile := p.current()
+	files := make(map[string]polledFile)
+	for _, m := range profile.GetMappings() {
+		matcher := p.w.matcherFor(p.profileName, profile, m)
+		filepath.WalkDir(m.Local, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			// Skip symlinks
+			if d.Type()&os.ModeSymlink != 0 {
+				return nil
+			}
+
+			if d.IsDir() {
+				if rel, err := filepath.Rel(m.Local, path); err == nil && rel != "." && matcher.Matches(rel, true) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			f := polledFile{size: info.Size(), modTime: info.ModTime()}
+			if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				f.inode = st.Ino
+			}
+			files[path] = f
+			return nil
+		})
+	}
+	return files
+}
+
+// poll scans again and reports what changed since the last scan. A file that
+// disappeared while a new one with the same inode appeared was renamed.
+func (p *poller) poll() {
+	// An unmounted share would look like every file was deleted
+	if err := p.check(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v (skipping scan)\n", p.profileName, err)
+		return
+	}
+
+	files := p.scan()
+
+	var created []string
+	for path, f := range files {
+		old, ok := p.files[path]
+		if !ok {
+			created = append(created, path)
+			continue
+		}
+		if f.size != old.size || !f.modTime.Equal(old.modTime) {
+			p.w.emit(Change{Op: OpUpload, Path: path})
+		}
+		if isIgnoreFile(path) && !f.modTime.Equal(old.modTime) {
+			p.w.reloadIgnores(p.profileName)
+		}
+	}
+
+	byInode := make(map[uint64]string)
+	for _, path := range created {
+		if inode := files[path].inode; inode != 0 {
+			byInode[inode] = path
+		}
+	}
+
+	renamed := make(map[string]bool)
+	for path, old := range p.files {
+		if _, ok := files[path]; ok {
+			continue
+		}
+		if newPath, ok := byInode[old.inode]; ok && old.inode != 0 {
+			p.w.emitRename(path, newPath, false)
+			renamed[newPath] = true
+			continue
+		}
+		p.w.emit(Change{Op: OpDelete, Path: path})
+	}
+
+	for _, path := range created {
+		if !renamed[path] {
+			p.w.emit(Change{Op: OpUpload, Path: path})
+		}
+	}
+
+	p.files = files
+}
+
+// check verifies the profile's directories still exist
+func (p *poller) check() error {
+	for _, m := range p.current().GetMappings() {
+		if _, err := os.Stat(m.Local); err != nil {
+			return fmt.Errorf("cannot scan %s: %w", m.Local, err)
+		}
+	}
+	return nil
+}
+
+// current returns the profile's settings, which Update may replace
+func (p *poller) current() *config.Profile {
+	if profile, ok := p.w.profile(p.profileName); ok {
+		return profile
+	}
+	return p.profile
+}
@@ -1,40 +1,85 @@
 package watcher
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"sftp-sync/internal/backup"
 	"sftp-sync/internal/config"
+	"sftp-sync/internal/history"
 	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/lock"
 	"sftp-sync/internal/syncignore"
+	"sftp-sync/internal/syncstate"
 )
 
+// ErrConflict means a file changed on the remote while its local copy
+// changed too, so the download would lose local edits
+var ErrConflict = errors.New("changed both locally and on the remote since the last sync")
+
+// commitTTL is how long a context's git commit is reused for history entries,
+// so a burst of changes doesn't run git for every file
+const commitTTL = 5 * time.Second
+
 // UploadQueue manages sequential file uploads with retry logic
 type UploadQueue struct {
 	queue      chan *uploadTask
 	profiles   map[string]*config.Profile
 	profilesMu sync.RWMutex
+
+	downloadsMu sync.Mutex
+	downloads   map[string]bool           // Queued downloads (profile name + path), so remote checks don't pile up
+	conflicts   map[string]syncstate.File // Local version each conflict was reported for
+
+	commitsMu sync.Mutex
+	commits   map[string]cachedCommit // Git commit per context (see commitTTL)
+}
+
+type cachedCommit struct {
+	commit string
+	at     time.Time
 }
 
 type uploadTask struct {
 	profileName string
 	filePath    string
+	op          Op
+	oldPath     string // Previous path for renames
+	isDir       bool
+	quiet       bool // Log success without calling onSuccess (no notification)
+	expected    bool // Written by a manual down or pull (see waitForIncoming)
 }
 
 // NewUploadQueue creates a new upload queue
 func NewUploadQueue(profiles map[string]*config.Profile) *UploadQueue {
 	return &UploadQueue{
-		queue:   make(chan *uploadTask, 100), // Buffer up to 100 pending uploads
-		profiles: profiles,
+		queue:     make(chan *uploadTask, 100), // Buffer up to 100 pending uploads
+		profiles:  profiles,
+		downloads: make(map[string]bool),
+		conflicts: make(map[string]syncstate.File),
+		commits:   make(map[string]cachedCommit),
 	}
 }
 
-// Enqueue adds a file to the upload queue
-func (q *UploadQueue) Enqueue(profileName, filePath string) {
+// Enqueue adds a change to the upload queue
+func (q *UploadQueue) Enqueue(profileName string, change Change) {
+	if change.Op == OpDownload {
+		q.downloadsMu.Lock()
+		key := profileName + ":" + change.Path
+		queued := q.downloads[key]
+		q.downloads[key] = true
+		q.downloadsMu.Unlock()
+		if queued {
+			return
+		}
+	}
+
 	// Warn if queue is getting full (80% capacity)
 	queueLen := len(q.queue)
 	queueCap := cap(q.queue)
@@ -45,21 +90,51 @@ func (q *UploadQueue) Enqueue(profileName, filePath string) {
 
 	q.queue <- &uploadTask{
 		profileName: profileName,
-		filePath:    filePath,
+		filePath:    change.Path,
+		op:          change.Op,
+		oldPath:     change.OldPath,
+		isDir:       change.IsDir,
+		quiet:       change.Quiet,
 	}
 }
 
 // Start starts processing the upload queue
-func (q *UploadQueue) Start(onSuccess func(profileName, filePath string), onError func(profileName, filePath string, err error, failCount int)) {
+// The callbacks get the change's path relative to its mapping (for renames, "old → new").
+func (q *UploadQueue) Start(onSuccess func(profileName string, op Op, relPath string), onError func(profileName string, op Op, relPath string, err error, failCount int)) {
 	go func() {
 		for task := range q.queue {
-			q.processUpload(task, onSuccess, onError)
+			// Manual runs hold the lock while writing, so wait for those first
+			waitForIncoming(task)
+
+			// Wait for manual up and down runs on the same profile
+			l, err := lock.Acquire(task.profileName, "daemon", true)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+			q.processTask(task, onSuccess, onError)
+			if l != nil {
+				l.Release()
+			}
 		}
 	}()
 }
 
-// processUpload handles uploading a single file with retry logic
-func (q *UploadQueue) processUpload(task *uploadTask, onSuccess func(string, string), onError func(string, string, error, int)) {
+// waitForIncoming waits until no manual down or pull is writing the task's
+// path, and marks the task if one was. It must not be called with the
+// profile lock held: the download holds it until it's done.
+func waitForIncoming(task *uploadTask) {
+	absFile, err := filepath.Abs(task.filePath)
+	if err != nil {
+		return
+	}
+	for syncstate.Expected(task.profileName, absFile) {
+		task.expected = true
+		time.Sleep(time.Second)
+	}
+}
+
+// processTask propagates a single change with retry logic
+func (q *UploadQueue) processTask(task *uploadTask, onSuccess func(string, Op, string), onError func(string, Op, string, error, int)) {
 	// Lock for reading profile
 	q.profilesMu.RLock()
 	profile, exists := q.profiles[task.profileName]
@@ -69,6 +144,10 @@ func (q *UploadQueue) processUpload(task *uploadTask, onSuccess func(string, str
 		fmt.Fprintf(os.Stderr, "Error: Profile '%s' not found\n", task.profileName)
 		return
 	}
+	if profile.DownloadOnly() && task.op != OpDownload {
+		fmt.Fprintf(os.Stderr, "Not uploading %s (%s only downloads)\n", task.filePath, task.profileName)
+		return
+	}
 
 	// Get absolute paths
 	absFile, err := filepath.Abs(task.filePath)
@@ -77,6 +156,14 @@ func (q *UploadQueue) processUpload(task *uploadTask, onSuccess func(string, str
 		return
 	}
 
+	// Scope the profile to the mapping that contains the file
+	mapping, ok := profile.MappingFor(absFile)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: File '%s' not within any mapping of '%s'\n", absFile, task.profileName)
+		return
+	}
+	profile = profile.ForMapping(mapping)
+
 	absContext, err := filepath.Abs(profile.Context)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Cannot resolve context path: %v\n", err)
@@ -95,42 +182,464 @@ func (q *UploadQueue) processUpload(task *uploadTask, onSuccess func(string, str
 	}
 
 	// Check .syncignore
-	patterns, err := syncignore.Load(absContext)
+	ignore, err := syncignore.ForProfile(profile, syncignore.Up)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to load .syncignore: %v\n", err)
 		// Continue anyway
 	}
 
-	if syncignore.ShouldIgnore(relPath, patterns) {
+	switch task.op {
+	case OpDownload:
+		q.processDownload(task, profile, absFile, relPath, onSuccess, onError)
+		return
+	case OpDelete:
+		if task.expected && !syncedBefore(task.profileName, absFile) {
+			return
+		}
+		q.processDelete(task, profile, ignore, absFile, relPath, onSuccess, onError)
+		return
+	case OpRename:
+		q.processRename(task, profile, ignore, absFile, relPath, onSuccess, onError)
+		return
+	}
+
+	if ignore.Matches(relPath, false) {
 		fmt.Fprintf(os.Stderr, "Ignored: %s (matched .syncignore)\n", relPath)
 		return
 	}
 
-	// Retry logic: 3 attempts with exponential backoff (1s, 2s, 4s)
+	// Downloads and saves without changes leave the last-synced version
+	if unchangedSinceSync(task.profileName, absFile) {
+		fmt.Fprintf(os.Stderr, "Unchanged since last sync: %s\n", relPath)
+		return
+	}
+
+	q.retry(task, profile, absFile, relPath, onSuccess, onError, func() error {
+		// Save the remote version before overwriting it
+		if err := backupRemote(task.profileName, profile, absFile); err != nil {
+			return err
+		}
+		return lftp.PushFile(profile, absFile)
+	})
+}
+
+// processDelete deletes the remote counterpart of a deleted local path
+func (q *UploadQueue) processDelete(task *uploadTask, profile *config.Profile, ignore *syncignore.Matcher, absFile, relPath string, onSuccess func(string, Op, string), onError func(string, Op, string, error, int)) {
+	if !profile.AutoSyncDelete {
+		fmt.Fprintf(os.Stderr, "Not deleting remote %s (autoSyncDelete is off)\n", relPath)
+		return
+	}
+
+	// Recreated since (atomic saves): its own event uploads it
+	if _, err := os.Lstat(absFile); err == nil {
+		return
+	}
+
+	// Ignored paths were never uploaded
+	if ignore.Matches(relPath, task.isDir) {
+		return
+	}
+
+	q.retry(task, profile, absFile, relPath, onSuccess, onError, func() error {
+		if task.isDir {
+			return deleteRemoteTree(task.profileName, profile, ignore, absFile, relPath)
+		}
+		if err := backupRemote(task.profileName, profile, absFile); err != nil {
+			return err
+		}
+		return lftp.DeleteRemote(profile, absFile, false)
+	})
+}
+
+// deleteRemoteTree deletes the remote counterpart of a deleted local directory.
+// A directory moved out of the tree gets no events for its contents, so the
+// files synced below it are deleted first (ignored and protected ones stay),
+// then the directories that leaves empty.
+func deleteRemoteTree(profileName string, profile *config.Profile, ignore *syncignore.Matcher, absDir, relDir string) error {
+	st, err := syncstate.Load(profileName)
+	if err != nil {
+		return err
+	}
+
+	files, dirs := treeDeletes(absDir, st.Within(absDir), func(absFile string) bool {
+		if ignore.Matches(relDir+strings.TrimPrefix(absFile, absDir), false) {
+			return true
+		}
+		remoteFile, err := lftp.RemoteFile(profile, absFile)
+		return err != nil || lftp.CheckProtected(profile, remoteFile) != nil
+	})
+
+	// Save the remote versions before deleting them
+	if len(files) > 0 {
+		var remoteFiles []string
+		for _, f := range files {
+			if remoteFile, err := lftp.RemoteFile(profile, f); err == nil {
+				remoteFiles = append(remoteFiles, remoteFile)
+			}
+		}
+		snapshot, err := backup.Remote(profileName, profile, "daemon", remoteFiles, nil)
+		if err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+		if snapshot != nil {
+			fmt.Fprintf(os.Stderr, "Backed up %d remote file(s) below %s (snapshot %s)\n", len(remoteFiles), relDir, snapshot.ID)
+		}
+	}
+
+	return lftp.DeleteRemoteTree(profile, files, dirs)
+}
+
+// treeDeletes splits the files synced below dir into those to delete (the ones
+// keep doesn't hold on to) and returns them with the directories that are
+// empty afterwards, deepest first and ending with dir itself. Directories
+// holding a kept file stay.
+func treeDeletes(dir string, synced []string, keep func(absFile string) bool) (files, dirs []string) {
+	dir = filepath.Clean(dir)
+	all := map[string]bool{dir: true}
+	kept := make(map[string]bool)
+	for _, f := range synced {
+		keepFile := keep(f)
+		if !keepFile {
+			files = append(files, f)
+		}
+		for d := filepath.Dir(f); d != dir && strings.HasPrefix(d, dir+"/"); d = filepath.Dir(d) {
+			all[d] = true
+			if keepFile {
+				kept[d] = true
+			}
+		}
+		if keepFile {
+			kept[dir] = true
+		}
+	}
+
+	for d := range all {
+		if !kept[d] {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if di, dj := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/"); di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+	sort.Strings(files)
+	return files, dirs
+}
+
+// processDownload fetches a file that changed on the remote, unless its local
+// copy changed since the last sync: that is a conflict, reported once per
+// local version, and the local file is left alone
+func (q *UploadQueue) processDownload(task *uploadTask, profile *config.Profile, absFile, relPath string, onSuccess func(string, Op, string), onError func(string, Op, string, error, int)) {
+	key := task.profileName + ":" + absFile
+	q.downloadsMu.Lock()
+	delete(q.downloads, key)
+	q.downloadsMu.Unlock()
+
+	st, err := syncstate.Load(task.profileName)
+	if err != nil {
+		onError(task.profileName, task.op, relPath, err, 1)
+		return
+	}
+
+	info, err := os.Lstat(absFile)
+	switch {
+	case err == nil && !info.Mode().IsRegular():
+		return
+	case err == nil && st.Changed(absFile, info):
+		version := syncstate.File{Size: info.Size(), ModTime: info.ModTime()}
+		if q.conflicts[key] == version {
+			return
+		}
+		q.conflicts[key] = version
+		onError(task.profileName, task.op, relPath, ErrConflict, 1)
+		return
+	case err != nil && st.Synced(absFile):
+		// Deleted locally since the last sync
+		return
+	}
+	delete(q.conflicts, key)
+
+	q.retry(task, profile, absFile, relPath, onSuccess, onError, func() error {
+		remoteFile, err := lftp.RemoteFile(profile, absFile)
+		if err != nil {
+			return err
+		}
+		// Save the local version before overwriting it
+		snapshot, err := backup.Local(task.profileName, profile, "daemon", []string{absFile})
+		if err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+		if snapshot != nil {
+			fmt.Fprintf(os.Stderr, "Backed up local %s (snapshot %s)\n", relPath, snapshot.ID)
+		}
+		if err := lftp.DownloadFiles(profile, map[string]string{remoteFile: absFile}); err != nil {
+			return err
+		}
+		if _, err := os.Stat(absFile); err != nil {
+			return lftp.ErrRemoteNotFound
+		}
+		return nil
+	})
+}
+
+// processRename renames the remote counterpart of a renamed local path. It
+// falls back to an upload (and a delete) when the remote can't simply be
+// renamed: the old path was ignored, is back, or never reached the remote.
+func (q *UploadQueue) processRename(task *uploadTask, profile *config.Profile, ignore *syncignore.Matcher, absFile, relPath string, onSuccess func(string, Op, string), onError func(string, Op, string, error, int)) {
+	upload := &uploadTask{profileName: task.profileName, filePath: task.filePath, op: OpUpload, quiet: task.quiet}
+	remove := &uploadTask{profileName: task.profileName, filePath: task.oldPath, op: OpDelete, isDir: task.isDir, quiet: task.quiet}
+
+	// Uploads what is now at the new path
+	uploadNew := func() {
+		if task.isDir {
+			q.uploadTree(task, profile, absFile, relPath, onSuccess, onError)
+		} else {
+			q.processTask(upload, onSuccess, onError)
+		}
+	}
+
+	if !profile.AutoSyncDelete {
+		uploadNew()
+		return
+	}
+
+	oldRel, err := filepath.Rel(profile.Context, task.oldPath)
+	if err != nil || strings.HasPrefix(oldRel, "..") {
+		// Moved in from another mapping
+		q.processTask(remove, onSuccess, onError)
+		uploadNew()
+		return
+	}
+
+	_, oldErr := os.Lstat(task.oldPath)
+	oldBack := oldErr == nil
+	oldIgnored := ignore.Matches(oldRel, task.isDir)
+	newIgnored := ignore.Matches(relPath, task.isDir)
+
+	switch {
+	case newIgnored && (oldIgnored || oldBack):
+		return
+	case newIgnored:
+		q.processTask(remove, onSuccess, onError)
+		return
+	case oldIgnored || oldBack:
+		uploadNew()
+		return
+	}
+
+	desc := oldRel + " → " + relPath
+	q.retry(task, profile, absFile, desc, onSuccess, onError, func() error {
+		if !task.isDir {
+			// Save the remote file the rename replaces, if any
+			if err := backupRemote(task.profileName, profile, absFile); err != nil {
+				return err
+			}
+		}
+		err := lftp.RenameRemote(profile, task.oldPath, absFile)
+		if errors.Is(err, lftp.ErrRemoteNotFound) {
+			// The old name never made it to the remote
+			if task.isDir {
+				return uploadFiles(task, profile, absFile, relPath)
+			}
+			return lftp.PushFile(profile, absFile)
+		}
+		return err
+	})
+}
+
+// uploadTree uploads the files of a local directory that aren't ignored
+func (q *UploadQueue) uploadTree(task *uploadTask, profile *config.Profile, absDir, relDir string, onSuccess func(string, Op, string), onError func(string, Op, string, error, int)) {
+	tree := &uploadTask{profileName: task.profileName, filePath: absDir, op: OpUpload, isDir: true, quiet: task.quiet}
+	q.retry(tree, profile, absDir, relDir, onSuccess, onError, func() error {
+		return uploadFiles(tree, profile, absDir, relDir)
+	})
+}
+
+// uploadFiles uploads the files of a local directory that aren't ignored,
+// backing up any remote files they replace, and records them as synced
+func uploadFiles(task *uploadTask, profile *config.Profile, absDir, relDir string) error {
+	files, err := lftp.ListLocal(profile, relDir, syncignore.Up)
+	if err != nil {
+		return err
+	}
+
+	transfers := make(map[string]string)
+	var localFiles, remoteFiles []string
+	for _, rel := range files {
+		local := filepath.Join(absDir, rel)
+		remote := filepath.Join(profile.RemotePath, relDir, rel)
+		transfers[local] = remote
+		localFiles = append(localFiles, local)
+		remoteFiles = append(remoteFiles, remote)
+	}
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	snapshot, err := backup.Remote(task.profileName, profile, "daemon", remoteFiles, nil)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if snapshot != nil {
+		fmt.Fprintf(os.Stderr, "Backed up remote files under %s (snapshot %s)\n", relDir, snapshot.ID)
+	}
+
+	if err := lftp.UploadFiles(profile, transfers); err != nil {
+		return err
+	}
+	return syncstate.Record(task.profileName, localFiles...)
+}
+
+// retry runs a remote operation up to 3 times with exponential backoff
+// (1s, 2s, 4s), records it in the history log and reports the outcome
+func (q *UploadQueue) retry(task *uploadTask, profile *config.Profile, absFile, relPath string, onSuccess func(string, Op, string), onError func(string, Op, string, error, int), run func() error) {
 	maxRetries := 3
 	delays := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second}
 
+	start := time.Now()
 	var lastErr error
+	attempts := 0
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		// Attempt upload
-		err := lftp.PushFile(profile, absFile)
+		attempts++
+		err := run()
 		if err == nil {
 			// Success
-			onSuccess(task.profileName, relPath)
+			recordSynced(task, absFile)
+			q.recordDaemon(task, profile, absFile, start, nil)
+			if task.quiet {
+				fmt.Fprintf(os.Stderr, "✓ Caught up (%s): %s → %s\n", task.op, relPath, task.profileName)
+				return
+			}
+			onSuccess(task.profileName, task.op, relPath)
 			return
 		}
 
 		lastErr = err
 
+		// Protected and read-only paths fail the same way every time, and so do
+		// downloads of files that are gone
+		if errors.Is(err, lftp.ErrProtected) || errors.Is(err, config.ErrReadOnlyProfile) || errors.Is(err, lftp.ErrRemoteNotFound) {
+			break
+		}
+
 		// If this isn't the last attempt, wait before retrying
 		if attempt < maxRetries-1 {
-			fmt.Fprintf(os.Stderr, "Upload failed (attempt %d/%d): %s - %v\n", attempt+1, maxRetries, relPath, err)
+			fmt.Fprintf(os.Stderr, "%s failed (attempt %d/%d): %s - %v\n", task.op, attempt+1, maxRetries, relPath, err)
 			time.Sleep(delays[attempt])
 		}
 	}
 
 	// All retries failed
-	onError(task.profileName, relPath, lastErr, maxRetries)
+	q.recordDaemon(task, profile, absFile, start, lastErr)
+	onError(task.profileName, task.op, relPath, lastErr, attempts)
+}
+
+// unchangedSinceSync reports whether a local file is in its last-synced version
+func unchangedSinceSync(profileName, absFile string) bool {
+	info, err := os.Stat(absFile)
+	if err != nil {
+		return false
+	}
+	st, err := syncstate.Load(profileName)
+	return err == nil && !st.Changed(absFile, info)
+}
+
+// syncedBefore reports whether a path, or a file below it, is recorded as synced
+func syncedBefore(profileName, absPath string) bool {
+	st, err := syncstate.Load(profileName)
+	return err != nil || st.Synced(absPath) || len(st.Within(absPath)) > 0
+}
+
+// recordSynced updates the sync state after a change reached the remote
+func recordSynced(task *uploadTask, absFile string) {
+	err := syncstate.Update(task.profileName, func(s *syncstate.State) {
+		switch task.op {
+		case OpDelete:
+			s.Forget(absFile)
+		case OpRename:
+			// The synced version moves along; the upload that follows a
+			// rename compares the file with it
+			s.Rename(task.oldPath, absFile)
+		default:
+			if !task.isDir { // Directory uploads record their files themselves
+				s.Record(absFile)
+			}
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to update sync state: %v\n", err)
+	}
+}
+
+// recordDaemon appends a change the daemon propagated to the history log.
+// Downloads have a direction of their own; the operation tells uploads,
+// deletes and renames apart.
+func (q *UploadQueue) recordDaemon(task *uploadTask, profile *config.Profile, absFile string, start time.Time, err error) {
+	entry := history.Entry{
+		Time:       start,
+		Profile:    task.profileName,
+		Direction:  history.DirectionDaemon,
+		Operation:  string(task.op),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	switch task.op {
+	case OpDownload:
+		entry.Direction = history.DirectionDaemonDown
+	case OpRename:
+		entry.OldPath = task.oldPath
+	}
+	if task.op != OpDownload {
+		entry.GitCommit = q.gitCommit(profile.Context)
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.FileCount = 1
+		entry.Files = []string{absFile}
+		if task.op != OpDelete && !task.isDir {
+			if info, statErr := os.Stat(absFile); statErr == nil {
+				entry.Bytes = info.Size()
+			}
+		}
+	}
+
+	if recordErr := history.Record(entry); recordErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to record history: %v\n", recordErr)
+	}
+}
+
+// gitCommit returns the git commit of a context, reusing a lookup made
+// within commitTTL
+func (q *UploadQueue) gitCommit(dir string) string {
+	q.commitsMu.Lock()
+	defer q.commitsMu.Unlock()
+
+	if c, ok := q.commits[dir]; ok && time.Since(c.at) < commitTTL {
+		return c.commit
+	}
+	commit := history.GitCommit(dir)
+	q.commits[dir] = cachedCommit{commit: commit, at: time.Now()}
+	return commit
+}
+
+// backupRemote saves the remote copy of a file before the daemon overwrites it
+func backupRemote(profileName string, profile *config.Profile, absFile string) error {
+	remoteFile, err := lftp.RemoteFile(profile, absFile)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := backup.Remote(profileName, profile, "daemon", []string{remoteFile}, nil)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if snapshot != nil {
+		fmt.Fprintf(os.Stderr, "Backed up remote %s (snapshot %s)\n", remoteFile, snapshot.ID)
+	}
+	return nil
 }
 
 // Stop stops the queue processor
@@ -0,0 +1,56 @@
+package watcher
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTreeDeletes(t *testing.T) {
+	synced := []string{
+		"/ctx/moved/a.txt",
+		"/ctx/moved/sub/b.txt",
+		"/ctx/moved/sub/deep/c.txt",
+		"/ctx/moved/keep/uploads/d.jpg",
+		"/ctx/moved/keep/e.txt",
+	}
+	keep := func(absFile string) bool { return strings.HasSuffix(absFile, ".jpg") }
+
+	files, dirs := treeDeletes("/ctx/moved/", synced, keep)
+
+	wantFiles := []string{
+		"/ctx/moved/a.txt",
+		"/ctx/moved/keep/e.txt",
+		"/ctx/moved/sub/b.txt",
+		"/ctx/moved/sub/deep/c.txt",
+	}
+	if !slices.Equal(files, wantFiles) {
+		t.Errorf("files = %q, want %q", files, wantFiles)
+	}
+	// Directories holding the kept file (and the moved directory itself) stay
+	wantDirs := []string{"/ctx/moved/sub/deep", "/ctx/moved/sub"}
+	if !slices.Equal(dirs, wantDirs) {
+		t.Errorf("dirs = %q, want %q", dirs, wantDirs)
+	}
+}
+
+func TestTreeDeletesRemovesMovedDirectory(t *testing.T) {
+	synced := []string{"/ctx/moved/a.txt", "/ctx/moved/sub/b.txt"}
+
+	files, dirs := treeDeletes("/ctx/moved", synced, func(string) bool { return false })
+
+	if want := []string{"/ctx/moved/a.txt", "/ctx/moved/sub/b.txt"}; !slices.Equal(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+	// Deepest first, so each rmdir finds its directory empty
+	if want := []string{"/ctx/moved/sub", "/ctx/moved"}; !slices.Equal(dirs, want) {
+		t.Errorf("dirs = %q, want %q", dirs, want)
+	}
+}
+
+func TestTreeDeletesEmpty(t *testing.T) {
+	files, dirs := treeDeletes("/ctx/moved", nil, func(string) bool { return false })
+	if len(files) != 0 || !slices.Equal(dirs, []string{"/ctx/moved"}) {
+		t.Errorf("files = %q, dirs = %q", files, dirs)
+	}
+}
@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sftp-sync/internal/config"
+	"sftp-sync/internal/lftp"
+	"sftp-sync/internal/syncstate"
+)
+
+// remoteClockSkew is how far the server's clock may be behind ours: each
+// remote check looks this much further back than the previous one started
+const remoteClockSkew = 2 * time.Minute
+
+// startRemotePoller checks the remote side of a profile every
+// autoSyncDownInterval seconds and reports the files changed there since the
+// daemon started. Each check uses the profile's current settings (Update may
+// have replaced them). Whether a file may be downloaded is decided when the
+// queue gets to it.
+func (w *Watcher) startRemotePoller(profileName string, profile *config.Profile, callback func(Change)) {
+	if !profile.AutoSyncDown {
+		return
+	}
+
+	stop := make(chan struct{})
+	w.mu.Lock()
+	w.remotes[profileName] = stop
+	w.mu.Unlock()
+
+	go func() {
+		interval := remoteInterval(profile)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		since := time.Now().Add(-remoteClockSkew)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				profile, exists := w.profile(profileName)
+				if !exists {
+					return
+				}
+				if i := remoteInterval(profile); i != interval {
+					interval = i
+					ticker.Reset(interval)
+				}
+
+				start := time.Now()
+				changes, err := remoteChanges(profileName, profile, since)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: Remote check for '%s' failed: %v\n", profileName, err)
+					continue
+				}
+				since = start.Add(-remoteClockSkew)
+				for _, change := range changes {
+					callback(change)
+				}
+			}
+		}
+	}()
+}
+
+// remoteInterval returns how often the remote side of a profile is checked
+func remoteInterval(profile *config.Profile) time.Duration {
+	if profile.AutoSyncDownInterval == 0 {
+		return 60 * time.Second // Default 60s
+	}
+	return time.Duration(profile.AutoSyncDownInterval) * time.Second
+}
+
+// stopRemotePoller stops checking the remote side of a profile
+func (w *Watcher) stopRemotePoller(profileName string) {
+	w.mu.Lock()
+	stop, ok := w.remotes[profileName]
+	delete(w.remotes, profileName)
+	w.mu.Unlock()
+
+	if ok {
+		close(stop)
+	}
+}
+
+// remoteChanges returns a download for each remote file modified after since
+// that is newer than its local copy or missing locally (ignore rules apply).
+// Files the daemon itself synced after since are left out: their remote
+// copy is the upload. Remote deletes are not propagated.
+func remoteChanges(profileName string, profile *config.Profile, since time.Time) ([]Change, error) {
+	st, err := syncstate.Load(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, m := range profile.GetMappings() {
+		ops, err := lftp.PlanDownSince(profile.ForMapping(m), "", since)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range ops {
+			absFile := filepath.Join(m.Local, op.Path)
+			if !st.SyncedSince(absFile, since) {
+				changes = append(changes, Change{Op: OpDownload, Path: absFile})
+			}
+		}
+	}
+	return changes, nil
+}
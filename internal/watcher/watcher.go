@@ -1,23 +1,81 @@
 package watcher
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
 	"sftp-sync/internal/config"
+	"sftp-sync/internal/notify"
+	"sftp-sync/internal/syncignore"
 )
 
+// renameWindow is how long a renamed path waits for the matching create
+// event before the rename is treated as a move out of the watched tree
+const renameWindow = 500 * time.Millisecond
+
+// Op is the kind of change the daemon propagates
+type Op string
+
+const (
+	OpUpload   Op = "upload"   // File created or modified
+	OpDelete   Op = "delete"   // File or directory deleted (or moved out of the watched tree)
+	OpRename   Op = "rename"   // File or directory renamed within the watched tree
+	OpDownload Op = "download" // File changed on the remote (autoSyncDown)
+)
+
+// Change is a local change to propagate to the remote, or a remote one to fetch
+type Change struct {
+	Op      Op
+	Path    string // Absolute local path (the new path for renames)
+	OldPath string // Previous path for renames
+	IsDir   bool
+	Quiet   bool // Don't notify for this change on its own (part of a summarized batch)
+}
+
+// pendingRename is the old half of a rename waiting for its create event
+type pendingRename struct {
+	path  string
+	isDir bool
+	id    fileID // Identity of the renamed file; the create event must match it
+	timer *time.Timer
+}
+
+// fileID identifies a file independently of its name
+type fileID struct {
+	dev, ino uint64
+}
+
+// idOf returns the identity of a file, or the zero fileID if it's unknown
+func idOf(info os.FileInfo) fileID {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileID{dev: uint64(st.Dev), ino: st.Ino}
+	}
+	return fileID{}
+}
+
 // Watcher watches file changes for auto-sync
 type Watcher struct {
 	fsWatcher *fsnotify.Watcher
 	debouncer *Debouncer
-	profiles  map[string]*config.Profile // profile name -> profile
-	callbacks map[string]func(string)    // profile name -> upload callback
+
+	mu        sync.Mutex
+	profiles  map[string]*config.Profile     // profile name -> profile
+	callbacks map[string]func(Change)        // profile name -> change callback
+	dirs      map[string]bool                // Watched directories
+	matchers  map[string]*syncignore.Matcher // profile name + mapping -> ignore rules
+	ids       map[string]fileID              // path -> identity, to pair renames
+	pollers   map[string]*poller             // profile name -> poller (watchMode poll)
+	remotes   map[string]chan struct{}       // profile name -> stop channel (autoSyncDown)
+	pending   *pendingRename
 }
 
 // New creates a new watcher
@@ -31,31 +89,144 @@ func New() (*Watcher, error) {
 		fsWatcher: fsWatcher,
 		debouncer: NewDebouncer(),
 		profiles:  make(map[string]*config.Profile),
-		callbacks: make(map[string]func(string)),
+		callbacks: make(map[string]func(Change)),
+		dirs:      make(map[string]bool),
+		matchers:  make(map[string]*syncignore.Matcher),
+		ids:       make(map[string]fileID),
+		pollers:   make(map[string]*poller),
+		remotes:   make(map[string]chan struct{}),
 	}, nil
 }
 
 // Watch starts watching a profile's context directory
-func (w *Watcher) Watch(profileName string, profile *config.Profile, callback func(filePath string)) error {
-	// Validate context exists
-	if _, err := os.Stat(profile.Context); os.IsNotExist(err) {
-		return fmt.Errorf("context directory doesn't exist: %s", profile.Context)
+func (w *Watcher) Watch(profileName string, profile *config.Profile, callback func(Change)) error {
+	// Validate local directories exist
+	mappings := profile.GetMappings()
+	for _, m := range mappings {
+		if _, err := os.Stat(m.Local); os.IsNotExist(err) {
+			return fmt.Errorf("context directory doesn't exist: %s", m.Local)
+		}
 	}
 
 	// Store profile and callback
+	w.mu.Lock()
 	w.profiles[profileName] = profile
 	w.callbacks[profileName] = callback
+	w.mu.Unlock()
+
+	var locals []string
+	for _, m := range mappings {
+		locals = append(locals, m.Local)
+	}
+
+	// Local changes of download-only profiles are never uploaded
+	if profile.DownloadOnly() {
+		w.startRemotePoller(profileName, profile, callback)
+		fmt.Fprintf(os.Stderr, "Watching: %s (%s) for remote changes only\n", profileName, strings.Join(locals, ", "))
+		return nil
+	}
 
-	// Add context directory to watcher (recursively)
-	if err := w.addRecursive(profile.Context); err != nil {
-		return fmt.Errorf("failed to watch directory: %w", err)
+	if reason := w.pollReason(profile); reason != "" {
+		w.startPoller(profileName, profile)
+		w.startRemotePoller(profileName, profile, callback)
+		fmt.Fprintf(os.Stderr, "Watching: %s (%s) by polling every %ds: %s\n", profileName, strings.Join(locals, ", "), profile.PollInterval, reason)
+		return nil
 	}
 
-	fmt.Fprintf(os.Stderr, "Watching: %s (%s)\n", profileName, profile.Context)
+	// Add each mapping's local directory to watcher (recursively)
+	for _, m := range mappings {
+		if err := w.addRecursive(m.Local); err != nil {
+			if errors.Is(err, syscall.ENOSPC) && profile.WatchMode == config.WatchAuto {
+				w.fallBackToPolling(profileName, profile)
+				w.startRemotePoller(profileName, profile, callback)
+				return nil
+			}
+			if errors.Is(err, syscall.ENOSPC) {
+				err = fmt.Errorf("%w (inotify watch limit reached: raise fs.inotify.max_user_watches or set watchMode to poll or auto)", err)
+			}
+			return fmt.Errorf("failed to watch directory: %w", err)
+		}
+	}
+
+	w.startRemotePoller(profileName, profile, callback)
+	fmt.Fprintf(os.Stderr, "Watching: %s (%s)\n", profileName, strings.Join(locals, ", "))
 	return nil
 }
 
-// addRecursive adds a directory and all its subdirectories to the watcher
+// pollReason returns why a profile should be polled instead of using
+// inotify, or "" if inotify works for it
+func (w *Watcher) pollReason(profile *config.Profile) string {
+	switch profile.WatchMode {
+	case config.WatchPoll:
+		return "watchMode is poll"
+	case config.WatchInotify:
+		return ""
+	}
+
+	// auto: inotify only sees changes made through the local kernel
+	for _, m := range profile.GetMappings() {
+		if fs := remoteFilesystem(m.Local); fs != "" {
+			return fmt.Sprintf("%s is on a %s filesystem, where inotify misses changes", m.Local, fs)
+		}
+	}
+	return ""
+}
+
+// fallBackToPolling switches a profile from inotify to polling after the
+// inotify watch limit was hit
+func (w *Watcher) fallBackToPolling(profileName string, profile *config.Profile) {
+	for _, m := range profile.GetMappings() {
+		w.removeRecursive(m.Local)
+	}
+	w.startPoller(profileName, profile)
+	fmt.Fprintf(os.Stderr, "Warning: %s: inotify watch limit reached (fs.inotify.max_user_watches); polling every %ds instead. Raise the limit or ignore large directories to use inotify.\n", profileName, profile.PollInterval)
+	notify.Warning("Auto-sync polling", fmt.Sprintf("%s: inotify watch limit reached, polling instead", profileName))
+}
+
+// Watching reports whether a profile is being watched
+func (w *Watcher) Watching(profileName string) bool {
+	_, exists := w.profile(profileName)
+	return exists
+}
+
+// profile returns the current settings of a watched profile
+func (w *Watcher) profile(profileName string) (*config.Profile, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	profile, exists := w.profiles[profileName]
+	return profile, exists
+}
+
+// watched returns a snapshot of the profiles whose local files are watched
+// (all but download-only ones)
+func (w *Watcher) watched() map[string]*config.Profile {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	profiles := make(map[string]*config.Profile, len(w.profiles))
+	for name, profile := range w.profiles {
+		if !profile.DownloadOnly() {
+			profiles[name] = profile
+		}
+	}
+	return profiles
+}
+
+// Update replaces the settings of a watched profile whose directories haven't
+// changed. Watches follow any change to its ignore settings.
+func (w *Watcher) Update(profileName string, profile *config.Profile) {
+	w.mu.Lock()
+	_, exists := w.profiles[profileName]
+	if exists {
+		w.profiles[profileName] = profile
+	}
+	w.mu.Unlock()
+	if exists {
+		w.reloadIgnores(profileName)
+	}
+}
+
+// addRecursive adds a directory and all its subdirectories to the watcher,
+// except ignored ones
 func (w *Watcher) addRecursive(root string) error {
 	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -69,30 +240,238 @@ func (w *Watcher) addRecursive(root string) error {
 
 		// Only watch directories
 		if info.IsDir() {
+			if path != root && w.ignoredDir(path) {
+				return filepath.SkipDir
+			}
 			if err := w.fsWatcher.Add(path); err != nil {
 				return err
 			}
+			w.mu.Lock()
+			w.dirs[path] = true
+			w.mu.Unlock()
+		}
+
+		w.remember(path, info)
+		return nil
+	})
+}
+
+// ignoredDir reports whether a directory is ignored by every watched mapping
+// that contains it. Ignored directories aren't watched at all.
+func (w *Watcher) ignoredDir(dir string) bool {
+	found := false
+	for name, profile := range w.watched() {
+		m, ok := profile.MappingFor(dir)
+		if !ok {
+			continue
+		}
+		found = true
+
+		rel, err := filepath.Rel(m.Local, dir)
+		if err != nil || rel == "." {
+			return false
+		}
+		if !w.matcherFor(name, profile, m).Matches(rel, true) {
+			return false
+		}
+	}
+	return found
+}
+
+// matcherFor returns the (cached) upload ignore rules of a profile's mapping
+func (w *Watcher) matcherFor(profileName string, profile *config.Profile, m config.Mapping) *syncignore.Matcher {
+	key := profileName + "\x00" + m.Local
+
+	w.mu.Lock()
+	matcher, ok := w.matchers[key]
+	w.mu.Unlock()
+	if ok {
+		return matcher
+	}
+
+	matcher, err := syncignore.ForProfile(profile.ForMapping(m), syncignore.Up)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load .syncignore: %v\n", err)
+	}
+
+	w.mu.Lock()
+	w.matchers[key] = matcher
+	w.mu.Unlock()
+	return matcher
+}
+
+// isIgnoreFile reports whether a path is a file that ignore rules are read from
+func isIgnoreFile(path string) bool {
+	switch filepath.Base(path) {
+	case syncignore.FileName, syncignore.IncludeFileName, syncignore.GitignoreFile:
+		return true
+	}
+	return false
+}
+
+// reloadIgnores drops the cached ignore rules of a profile and updates its
+// watches to match the current rules: newly ignored directories are
+// unwatched, no longer ignored ones are watched
+func (w *Watcher) reloadIgnores(profileName string) {
+	profile, exists := w.profile(profileName)
+	if !exists || profile.DownloadOnly() {
+		return
+	}
+
+	w.mu.Lock()
+	for key := range w.matchers {
+		if strings.HasPrefix(key, profileName+"\x00") {
+			delete(w.matchers, key)
+		}
+	}
+	w.mu.Unlock()
+
+	// Polling picks the new rules up on its next scan
+	if w.polled(profileName) {
+		return
+	}
+	for _, m := range profile.GetMappings() {
+		w.rescan(m.Local)
+	}
+}
+
+// rescan brings the watches below root in line with the ignore rules
+func (w *Watcher) rescan(root string) {
+	wanted := make(map[string]bool)
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if d.IsDir() && path != root && w.ignoredDir(path) {
+			return filepath.SkipDir
+		}
+		if info, err := d.Info(); err == nil {
+			w.remember(path, info)
+		}
+		if d.IsDir() {
+			wanted[path] = true
+		}
+		return nil
+	})
+
+	w.mu.Lock()
+	var added, removed int
+	for dir := range w.dirs {
+		if (dir == root || strings.HasPrefix(dir, root+"/")) && !wanted[dir] {
+			w.fsWatcher.Remove(dir)
+			delete(w.dirs, dir)
+			removed++
+		}
+	}
+	for dir := range wanted {
+		if !w.dirs[dir] {
+			if err := w.fsWatcher.Add(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to watch %s: %v\n", dir, err)
+				continue
+			}
+			w.dirs[dir] = true
+			added++
+		}
+	}
+	w.mu.Unlock()
+
+	if added > 0 || removed > 0 {
+		fmt.Fprintf(os.Stderr, "Ignore rules changed: watching %d more, %d fewer directories under %s\n", added, removed, root)
+	}
+}
+
+// addTree watches a directory that just appeared and everything below it, and
+// uploads the files already in it. Files written after their directory is
+// watched also get events of their own; both share a debounce key, so each
+// file is uploaded once.
+func (w *Watcher) addTree(root string) {
+	w.watchTree(root, true)
+}
+
+// watchTree watches a directory and everything below it that isn't ignored,
+// including root itself, and with upload set emits an upload for each file.
+// Running out of inotify watches switches profiles in auto mode to polling.
+func (w *Watcher) watchTree(root string, upload bool) {
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil // Gone again, or unreadable
+		}
+
+		// Skip symlinks
+		if d.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		if d.IsDir() {
+			if w.ignoredDir(path) {
+				return filepath.SkipDir
+			}
+			if err := w.fsWatcher.Add(path); err != nil {
+				if errors.Is(err, syscall.ENOSPC) {
+					w.watchLimitReached(path)
+					return filepath.SkipAll
+				}
+				fmt.Fprintf(os.Stderr, "Warning: Failed to watch %s: %v\n", path, err)
+				return filepath.SkipDir
+			}
+			w.mu.Lock()
+			w.dirs[path] = true
+			w.mu.Unlock()
+			if info, err := d.Info(); err == nil {
+				w.remember(path, info)
+			}
+			return nil
 		}
 
+		if info, err := d.Info(); err == nil {
+			w.remember(path, info)
+		}
+		if upload {
+			w.emit(Change{Op: OpUpload, Path: path})
+		}
 		return nil
 	})
 }
 
+// watchLimitReached handles running out of inotify watches while a new
+// directory is added: profiles in auto mode that contain it switch to polling
+func (w *Watcher) watchLimitReached(dir string) {
+	fmt.Fprintf(os.Stderr, "Warning: Cannot watch %s: inotify watch limit reached\n", dir)
+	for name, profile := range w.watched() {
+		if _, ok := profile.MappingFor(dir); ok && profile.WatchMode == config.WatchAuto && !w.polled(name) {
+			w.fallBackToPolling(name, profile)
+		}
+	}
+}
+
 // Unwatch stops watching a profile
 func (w *Watcher) Unwatch(profileName string) error {
-	profile, exists := w.profiles[profileName]
+	profile, exists := w.profile(profileName)
 	if !exists {
 		return fmt.Errorf("profile not watched: %s", profileName)
 	}
 
-	// Remove context directory from watcher
-	if err := w.removeRecursive(profile.Context); err != nil {
-		return err
+	w.stopRemotePoller(profileName)
+
+	// Stop polling, or remove local directories from watcher
+	if !w.stopPoller(profileName) && !profile.DownloadOnly() {
+		for _, m := range profile.GetMappings() {
+			if err := w.removeRecursive(m.Local); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Remove from maps
+	w.mu.Lock()
 	delete(w.profiles, profileName)
 	delete(w.callbacks, profileName)
+	for key := range w.matchers {
+		if strings.HasPrefix(key, profileName+"\x00") {
+			delete(w.matchers, key)
+		}
+	}
+	w.mu.Unlock()
 
 	fmt.Fprintf(os.Stderr, "Stopped watching: %s\n", profileName)
 	return nil
@@ -107,12 +486,53 @@ func (w *Watcher) removeRecursive(root string) error {
 
 		if info.IsDir() {
 			w.fsWatcher.Remove(path)
+			w.mu.Lock()
+			delete(w.dirs, path)
+			w.mu.Unlock()
 		}
 
 		return nil
 	})
 }
 
+// forgetDirs drops the watches of a directory that no longer exists and of
+// everything below it. Returns whether path was a watched directory.
+func (w *Watcher) forgetDirs(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wasDir := w.dirs[path]
+	for dir := range w.dirs {
+		if dir == path || strings.HasPrefix(dir, path+"/") {
+			w.fsWatcher.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+	return wasDir
+}
+
+// remember records the identity of a path, so a rename of it can be recognized
+func (w *Watcher) remember(path string, info os.FileInfo) {
+	w.mu.Lock()
+	w.ids[path] = idOf(info)
+	w.mu.Unlock()
+}
+
+// forgetID drops the identities of a path that no longer exists and of
+// everything below it. Returns the identity of path itself.
+func (w *Watcher) forgetID(path string) fileID {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.ids[path]
+	for p := range w.ids {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(w.ids, p)
+		}
+	}
+	return id
+}
+
 // Start starts processing file system events
 func (w *Watcher) Start() {
 	go func() {
@@ -123,8 +543,10 @@ func (w *Watcher) Start() {
 					return
 				}
 
-				// Only process WRITE and CREATE events
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+				// Renames report the old path (the new one gets a CREATE event)
+				if event.Op&fsnotify.Remove == fsnotify.Remove || event.Op&fsnotify.Rename == fsnotify.Rename {
+					w.handleRemove(event)
+				} else if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
 					w.handleEvent(event)
 				}
 
@@ -149,10 +571,28 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 		return
 	}
 
+	// A create right after a rename is the new name of the renamed path, if
+	// it is the same file
+	id := idOf(info)
+	w.remember(filePath, info)
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if old := w.takePendingRename(&id); old != nil {
+			if info.IsDir() {
+				// The rename moves the remote files; only watches are needed
+				w.watchTree(filePath, false)
+			} else if isIgnoreFile(filePath) {
+				w.ignoreFileChanged(filePath)
+			}
+			w.emitRename(old.path, filePath, info.IsDir())
+			return
+		}
+	}
+
 	if info.IsDir() {
-		// Directory created - add to watcher
+		// Directory created - it may already hold files and subdirectories
+		// (mkdir -p, mv, unzip, git checkout)
 		if event.Op&fsnotify.Create == fsnotify.Create {
-			w.fsWatcher.Add(filePath)
+			w.addTree(filePath)
 		}
 		return
 	}
@@ -162,12 +602,116 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 		return
 	}
 
+	if isIgnoreFile(filePath) {
+		w.ignoreFileChanged(filePath)
+	}
+
+	w.emit(Change{Op: OpUpload, Path: filePath})
+}
+
+// ignoreFileChanged reloads the ignore rules of the profiles an ignore file belongs to
+func (w *Watcher) ignoreFileChanged(path string) {
+	for name, profile := range w.watched() {
+		if _, ok := profile.MappingFor(path); ok {
+			w.reloadIgnores(name)
+		}
+	}
+}
+
+// handleRemove processes the removal or renaming of a path. A rename is held
+// back briefly so it can be paired with the create event of the new name;
+// unpaired it becomes a delete.
+func (w *Watcher) handleRemove(event fsnotify.Event) {
+	path := event.Name
+	id := w.forgetID(path)
+	isDir := w.forgetDirs(path)
+
+	if !isDir && isIgnoreFile(path) {
+		w.ignoreFileChanged(path)
+	}
+
+	if event.Op&fsnotify.Rename != fsnotify.Rename {
+		w.emit(Change{Op: OpDelete, Path: path, IsDir: isDir})
+		return
+	}
+
+	// A previous rename that is still unpaired was a move out of the tree
+	if old := w.takePendingRename(nil); old != nil {
+		w.emit(Change{Op: OpDelete, Path: old.path, IsDir: old.isDir})
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending := &pendingRename{path: path, isDir: isDir, id: id}
+	pending.timer = time.AfterFunc(renameWindow, func() {
+		w.mu.Lock()
+		expired := w.pending == pending
+		if expired {
+			w.pending = nil
+		}
+		w.mu.Unlock()
+		if expired {
+			w.emit(Change{Op: OpDelete, Path: pending.path, IsDir: pending.isDir})
+		}
+	})
+	w.pending = pending
+}
+
+// takePendingRename returns and clears the rename waiting for its new name,
+// if any. With id set, only a rename of that (known) file is taken.
+func (w *Watcher) takePendingRename(id *fileID) *pendingRename {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pending := w.pending
+	if pending == nil {
+		return nil
+	}
+	if id != nil && (pending.id == fileID{} || pending.id != *id) {
+		return nil
+	}
+	pending.timer.Stop()
+	w.pending = nil
+	return pending
+}
+
+// emitRename reports a rename to the profiles of the new path. If the old
+// path belongs elsewhere, it becomes a delete there and an upload here.
+func (w *Watcher) emitRename(oldPath, newPath string, isDir bool) {
+	// Anything still pending for the old name is obsolete
+	for _, profileName := range w.findMatchingProfiles(oldPath) {
+		w.debouncer.Stop(profileName + ":" + oldPath)
+	}
+
+	if !slices.Equal(w.findMatchingProfiles(oldPath), w.findMatchingProfiles(newPath)) {
+		w.emit(Change{Op: OpDelete, Path: oldPath, IsDir: isDir})
+		if !isDir {
+			w.emit(Change{Op: OpUpload, Path: newPath})
+		}
+		return
+	}
+	w.emit(Change{Op: OpRename, Path: newPath, OldPath: oldPath, IsDir: isDir})
+
+	// Content written under the old name before the rename, or under the new
+	// one since, follows as an upload (skipped if it's the synced version)
+	if !isDir {
+		w.emit(Change{Op: OpUpload, Path: newPath})
+	}
+}
+
+// emit hands a change to the profile(s) its path belongs to, debounced per path
+func (w *Watcher) emit(change Change) {
 	// Find which profile(s) this file belongs to
-	matchedProfiles := w.findMatchingProfiles(filePath)
+	matchedProfiles := w.findMatchingProfiles(change.Path)
 
 	for _, profileName := range matchedProfiles {
-		profile := w.profiles[profileName]
+		w.mu.Lock()
+		profile, exists := w.profiles[profileName]
 		callback := w.callbacks[profileName]
+		w.mu.Unlock()
+		if !exists {
+			continue // Unwatched meanwhile
+		}
 
 		// Get debounce delay
 		delay := time.Duration(profile.AutoSyncDebounce) * time.Millisecond
@@ -175,29 +719,38 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 			delay = 2000 * time.Millisecond // Default 2s
 		}
 
-		// Debounce key: profileName + filePath
-		debounceKey := profileName + ":" + filePath
+		// Debounce key: profileName + filePath. The latest change to a path
+		// wins, so a file deleted and recreated (atomic saves) is just uploaded.
+		debounceKey := profileName + ":" + change.Path
+
+		// Renames aren't debounced, so a write to the new path can't replace
+		// them; it is uploaded after the rename
+		if change.Op == OpRename {
+			w.debouncer.Stop(debounceKey)
+			callback(change)
+			continue
+		}
 
 		// Add debounced callback
 		w.debouncer.Add(debounceKey, delay, func() {
-			callback(filePath)
+			callback(change)
 		})
 	}
 }
 
 // findMatchingProfiles finds which profile(s) a file belongs to
-// Returns profile names sorted by context specificity (most specific first)
+// Returns profile names sorted by mapping specificity (most specific first)
 func (w *Watcher) findMatchingProfiles(filePath string) []string {
 	var matches []struct {
 		name  string
 		depth int
 	}
 
-	for name, profile := range w.profiles {
-		// Check if file is under this profile's context
-		if strings.HasPrefix(filePath, profile.Context+"/") || filePath == profile.Context {
+	for name, profile := range w.watched() {
+		// Check if file is under one of this profile's local directories
+		if m, ok := profile.MappingFor(filePath); ok {
 			// Calculate depth (number of path separators)
-			depth := strings.Count(profile.Context, string(os.PathSeparator))
+			depth := strings.Count(filepath.Clean(m.Local), string(os.PathSeparator))
 			matches = append(matches, struct {
 				name  string
 				depth int
@@ -225,6 +778,7 @@ func (w *Watcher) findMatchingProfiles(filePath string) []string {
 			result = append(result, m.name)
 		}
 	}
+	slices.Sort(result)
 
 	return result
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 
 	"sftp-sync/cmd"
 )
@@ -30,71 +33,195 @@ func main() {
 
 	switch command {
 	case "up":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: sftp-sync up <profile> [file]")
+		args, flags := parseArgs(os.Args[2:], "--concurrency")
+		if len(args) < 1 {
+			fmt.Println("Usage: sftp-sync up <profile|group|p1,p2> [file|dir] [--release] [--concurrency N] [--fail-fast] [--dry-run] [--force] [--yes] [--wait]")
 			os.Exit(1)
 		}
-		// Optional file argument for editor integration
-		var contextFile string
-		if len(os.Args) >= 4 {
-			contextFile = os.Args[3]
+		// Optional file (editor integration) or directory (subtree sync)
+		var target string
+		if len(args) >= 2 {
+			target = args[1]
+		}
+		opts := cmd.SyncOptions{
+			Release:  flags.has("--release"),
+			FailFast: flags.has("--fail-fast"),
+			DryRun:   flags.has("--dry-run"),
+			Force:    flags.has("--force"),
+			Yes:      flags.has("--yes"),
+			Wait:     flags.has("--wait"),
 		}
-		if err := cmd.Up(os.Args[2], contextFile); err != nil {
+		if flags.has("--concurrency") {
+			n, err := strconv.Atoi(flags["--concurrency"])
+			if err != nil || n < 1 {
+				fmt.Println("Error: --concurrency must be a positive number")
+				os.Exit(1)
+			}
+			opts.Concurrency = n
+		}
+		if err := cmd.Up(args[0], target, opts); err != nil {
 			os.Exit(1)
 		}
 
 	case "down":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: sftp-sync down <profile> [file]")
+		args, flags := parseArgs(os.Args[2:], "--commit-to")
+		if len(args) < 1 {
+			fmt.Println("Usage: sftp-sync down <profile> [file|dir] [--dry-run] [--force] [--yes] [--stash] [--commit-to <branch>] [--wait]")
 			os.Exit(1)
 		}
-		// Optional file argument for editor integration
-		var contextFile string
-		if len(os.Args) >= 4 {
-			contextFile = os.Args[3]
+		// Optional file (editor integration) or directory (subtree sync)
+		var target string
+		if len(args) >= 2 {
+			target = args[1]
+		}
+		opts := cmd.SyncOptions{
+			DryRun:   flags.has("--dry-run"),
+			Force:    flags.has("--force"),
+			Yes:      flags.has("--yes"),
+			Stash:    flags.has("--stash"),
+			CommitTo: flags["--commit-to"],
+			Wait:     flags.has("--wait"),
 		}
-		if err := cmd.Down(os.Args[2], contextFile); err != nil {
+		if err := cmd.Down(args[0], target, opts); err != nil {
 			os.Exit(1)
 		}
 
 	case "diff":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: sftp-sync diff <profile> [file]")
+			fmt.Println("Usage: sftp-sync diff <profile> [file|dir]")
 			os.Exit(1)
 		}
-		// Optional file argument for editor integration
-		var contextFile string
+		// Optional file (editor integration) or directory (subtree diff)
+		var target string
 		if len(os.Args) >= 4 {
-			contextFile = os.Args[3]
+			target = os.Args[3]
 		}
-		if err := cmd.Diff(os.Args[2], contextFile); err != nil {
+		if err := cmd.Diff(os.Args[2], target); err != nil {
 			os.Exit(1)
 		}
 
 	case "push":
-		if len(os.Args) < 4 {
-			fmt.Println("Usage: sftp-sync push <profile> <file>")
+		args, flags := parseArgs(os.Args[2:])
+		if len(args) < 2 {
+			fmt.Println("Usage: sftp-sync push <profile> <file> [--dry-run] [--yes] [--wait]")
 			os.Exit(1)
 		}
-		if err := cmd.Push(os.Args[2], os.Args[3]); err != nil {
+		opts := cmd.SyncOptions{
+			DryRun: flags.has("--dry-run"),
+			Yes:    flags.has("--yes"),
+			Wait:   flags.has("--wait"),
+		}
+		if err := cmd.Push(args[0], args[1], opts); err != nil {
 			os.Exit(1)
 		}
 
 	case "pull":
-		if len(os.Args) < 4 {
-			fmt.Println("Usage: sftp-sync pull <profile> <file>")
+		args, flags := parseArgs(os.Args[2:])
+		if len(args) < 2 {
+			fmt.Println("Usage: sftp-sync pull <profile> <file> [--dry-run] [--wait]")
 			os.Exit(1)
 		}
-		if err := cmd.Pull(os.Args[2], os.Args[3]); err != nil {
+		opts := cmd.SyncOptions{
+			DryRun: flags.has("--dry-run"),
+			Wait:   flags.has("--wait"),
+		}
+		if err := cmd.Pull(args[0], args[1], opts); err != nil {
 			os.Exit(1)
 		}
 
 	case "current":
-		if len(os.Args) < 4 {
-			fmt.Println("Usage: sftp-sync current <profile> <file>")
+		args, flags := parseArgs(os.Args[2:])
+		if len(args) < 2 {
+			fmt.Println("Usage: sftp-sync current <profile> <file> [--dry-run] [--yes] [--wait]")
+			os.Exit(1)
+		}
+		opts := cmd.SyncOptions{
+			DryRun: flags.has("--dry-run"),
+			Yes:    flags.has("--yes"),
+			Wait:   flags.has("--wait"),
+		}
+		if err := cmd.Current(args[0], args[1], opts); err != nil {
+			os.Exit(1)
+		}
+
+	case "check-ignore":
+		args, flags := parseArgs(os.Args[2:], "--direction")
+		if len(args) < 2 {
+			fmt.Println("Usage: sftp-sync check-ignore <profile> <path>... [--direction up|down]")
 			os.Exit(1)
 		}
-		if err := cmd.Current(os.Args[2], os.Args[3]); err != nil {
+		if err := cmd.CheckIgnore(args[0], args[1:], flags["--direction"]); err != nil {
+			os.Exit(1)
+		}
+
+	case "history":
+		args, flags := parseArgs(os.Args[2:], "--direction", "--since", "--limit")
+		var profileName string
+		if len(args) >= 1 {
+			profileName = args[0]
+		}
+		opts := cmd.HistoryOptions{
+			Direction: flags["--direction"],
+			Since:     flags["--since"],
+			Failed:    flags.has("--failed"),
+			JSON:      flags.has("--json"),
+		}
+		if flags.has("--limit") {
+			n, err := strconv.Atoi(flags["--limit"])
+			if err != nil || n < 1 {
+				fmt.Println("Error: --limit must be a positive number")
+				os.Exit(1)
+			}
+			opts.Limit = n
+		}
+		if err := cmd.History(profileName, opts); err != nil {
+			os.Exit(1)
+		}
+
+	case "backups":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: sftp-sync backups <profile>")
+			os.Exit(1)
+		}
+		if err := cmd.Backups(os.Args[2]); err != nil {
+			os.Exit(1)
+		}
+
+	case "restore":
+		args, flags := parseArgs(os.Args[2:])
+		if len(args) < 2 {
+			fmt.Println("Usage: sftp-sync restore <profile> <snapshot> [path] [--dry-run] [--yes] [--wait]")
+			os.Exit(1)
+		}
+		var filter string
+		if len(args) >= 3 {
+			filter = args[2]
+		}
+		opts := cmd.SyncOptions{
+			DryRun: flags.has("--dry-run"),
+			Yes:    flags.has("--yes"),
+			Wait:   flags.has("--wait"),
+		}
+		if err := cmd.Restore(args[0], args[1], filter, opts); err != nil {
+			os.Exit(1)
+		}
+
+	case "rollback":
+		args, flags := parseArgs(os.Args[2:])
+		if len(args) < 1 {
+			fmt.Println("Usage: sftp-sync rollback <profile> [release] [--dry-run] [--yes] [--wait]")
+			os.Exit(1)
+		}
+		var target string
+		if len(args) >= 2 {
+			target = args[1]
+		}
+		opts := cmd.SyncOptions{
+			DryRun: flags.has("--dry-run"),
+			Yes:    flags.has("--yes"),
+			Wait:   flags.has("--wait"),
+		}
+		if err := cmd.Rollback(args[0], target, opts); err != nil {
 			os.Exit(1)
 		}
 
@@ -163,20 +290,92 @@ func main() {
 	}
 }
 
+// flagSet holds the --flags given on the command line
+type flagSet map[string]string
+
+// has reports whether a flag was given
+func (f flagSet) has(name string) bool {
+	_, ok := f[name]
+	return ok
+}
+
+// parseArgs separates positional arguments from --flags.
+// Flags listed in valueFlags take the next argument as their value
+// (--flag value or --flag=value).
+func parseArgs(args []string, valueFlags ...string) ([]string, flagSet) {
+	var positional []string
+	flags := make(flagSet)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			flags[name] = value
+			continue
+		}
+
+		flags[arg] = ""
+		if slices.Contains(valueFlags, arg) && i+1 < len(args) {
+			flags[arg] = args[i+1]
+			i++
+		}
+	}
+
+	return positional, flags
+}
+
 func printUsage() {
-	fmt.Println(`sftp-sync - FTP/SFTP synchronization and mounting tool
+	fmt.Print(`sftp-sync - FTP/SFTP synchronization and mounting tool
 
 USAGE:
   sftp-sync <command> <profile> [options]
 
 SYNC COMMANDS:
   up <profile>              Upload local directory to remote (full sync)
+  up <profile> --release    Upload into a new release and switch the current symlink
+  up <profile> <dir>        Upload only one directory of the project
+  up <group|p1,p2>          Upload to several profiles concurrently
+                            (--concurrency N, --fail-fast)
   down <profile>            Download remote directory to local (full sync)
+  down <profile> <dir>      Download only one directory of the project
   diff <profile>            Show what would be uploaded (dry-run)
   push <profile> <file>     Upload a single file
   pull <profile> <file>     Download a single file
   current <profile> <file>  Upload current file (editor integration)
 
+  up, down, push, pull, restore and rollback accept --dry-run to print the
+  transfers, deletions, mkdirs and chmods they would perform, in the same
+  format as a real run, without changing anything.
+
+  up and down refuse to delete more than deleteLimit files / deleteLimitPercent
+  of the destination, or to mirror an empty source; --force overrides.
+
+  Profiles with "protected": true ask for the profile name to be typed before
+  up, down, push, restore or rollback change anything; pass --yes when not
+  running on a terminal.
+
+  Only one up, down, push, pull, restore, rollback or daemon transfer runs
+  against a profile at a time; a second one fails with "profile busy (pid N,
+  operation X)", or with --wait waits its turn.
+
+  In a git repository, down refuses to overwrite or delete files with
+  uncommitted changes: --stash stashes them, --force overwrites them (they
+  stay in the backup snapshot). --commit-to <branch> records the downloaded
+  state as a commit on that branch without touching HEAD.
+
+BACKUP COMMANDS:
+  backups <profile>         List backup snapshots
+  restore <profile> <snapshot> [path]
+                            Restore files from a backup snapshot
+
+RELEASE COMMANDS:
+  rollback <profile>        Switch current symlink back to the previous release
+  rollback <profile> <rel>  Switch current symlink to a specific release
+
 MOUNT COMMANDS:
   mount <profile>           Mount remote filesystem
   mount <profile> --yazi    Mount and open in yazi file manager
@@ -189,6 +388,15 @@ DAEMON COMMANDS:
   install-daemon            Install systemd service for auto-sync
   uninstall-daemon          Remove systemd service
 
+IGNORE COMMANDS:
+  check-ignore <profile> <path>...
+                            Show whether paths are ignored and which rule from
+                            which file decided it (--direction up|down)
+
+HISTORY COMMANDS:
+  history [profile]         Show recorded syncs (--direction D, --since 24h|7d|DATE,
+                            --limit N, --failed, --json)
+
 OTHER:
   version                   Show version information
   help                      Show this help message
@@ -208,11 +416,16 @@ CONFIGURATION:
       "context": "/home/user/projects/website",
       "autoSync": true,
       "autoSyncDebounce": 2000
+    },
+    "groups": {
+      "web": ["web1", "web2", "web3"]
     }
   }
 
 EXAMPLES:
   sftp-sync up myserver
+  sftp-sync up web --fail-fast
+  sftp-sync down myserver --dry-run
   sftp-sync mount myserver --yazi
   sftp-sync push myserver index.html
   sftp-sync unmount --all